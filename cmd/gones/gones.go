@@ -1,41 +1,299 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/datadir"
 	logger2 "github.com/vfreex/gones/pkg/emulator/common/logger"
+	"github.com/vfreex/gones/pkg/emulator/movie"
 	"github.com/vfreex/gones/pkg/emulator/nes"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rewind"
+	"github.com/vfreex/gones/pkg/emulator/rom/archive"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/fds"
 	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/patch"
+	"github.com/vfreex/gones/pkg/emulator/rom/romdb"
+	"github.com/vfreex/gones/pkg/emulator/rom/unif"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 var logger = logger2.GetLogger()
 
 func main() {
 	var fileName string
+	ramInit := flag.String("ram-init", "zeros", "power-on RAM contents: zeros, ff, pattern or random")
+	ramSeed := flag.Int64("ram-seed", 0, "seed for random power-on RAM contents (default: current time)")
+	dataDir := flag.String("data-dir", "", "directory for save states (default: per-user data directory)")
+	saveDir := flag.String("save-dir", "", "directory for the .sav files of battery-backed games (default: saves in the data directory)")
+	rewindInterval := flag.Int("rewind-interval", rewind.DEFAULT_INTERVAL, "frames between rewind snapshots")
+	rewindBudget := flag.Int("rewind-budget", rewind.DEFAULT_MEMORY_BUDGET>>20, "memory for rewind history in MiB")
+	recordMovie := flag.String("record", "", "record the input into a FM2 movie file")
+	playMovie := flag.String("play", "", "play back the input of a FM2 movie file")
+	regionName := flag.String("region", "auto", "console timing: auto (from the ROM header), ntsc, pal or dendy")
+	headless := flag.Bool("headless", false, "run without a window, for the number of frames given by -frames")
+	frames := flag.Int("frames", 0, "frames to emulate in headless mode (default: until the played movie ends)")
+	noRomDB := flag.Bool("no-romdb", false, "trust the ROM header instead of correcting it from the ROM database")
+	entry := flag.String("entry", "", "ROM to load from an archive with several ROMs")
+	patchFile := flag.String("patch", "", "IPS, UPS or BPS patch to apply to the ROM (default: <rom>.bps/.ups/.ips if present)")
+	fdsBios := flag.String("fds-bios", "", "Famicom Disk System BIOS (default: disksys.rom in the data directory)")
+	romDBFile := flag.String("romdb", "", "additional ROM database in the NES 2.0 or NesCartDB XML format")
 	flag.Parse()
 	if flag.NArg() > 0 {
 		fileName = flag.Arg(0)
 	}
 
 	if len(fileName) == 0 {
-		fmt.Fprintf(os.Stderr, "GoNES v0.3.0-beta\n\nUsage:\n\t<rom-file>\n")
+		fmt.Fprintf(os.Stderr, "GoNES v0.3.0-beta\n\nUsage:\n\t[options] <rom-file>\n\nOptions:\n")
+		flag.PrintDefaults()
 		os.Exit(1)
 		return
 	}
 
-	romFile, err := os.Open(fileName)
+	config := nes.Config{
+		RAMSeed:            *ramSeed,
+		DataDir:            *dataDir,
+		SaveDir:            *saveDir,
+		RewindInterval:     *rewindInterval,
+		RewindMemoryBudget: *rewindBudget << 20,
+	}
+	var err error
+	if config.RAMInit, err = ram.ParseInitPattern(*ramInit); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if config.Region, err = region.ParseRegion(*regionName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if config.RAMInit == ram.INIT_RANDOM && !isFlagSet("ram-seed") {
+		config.RAMSeed = time.Now().UnixNano()
+	}
+	logger.Infof("power-on RAM contents: %v, seed: %v", config.RAMInit, config.RAMSeed)
+
+	if *romDBFile != "" {
+		if err := loadRomDB(*romDBFile); err != nil {
+			panic(fmt.Errorf("error loading ROM database: %v - %v", *romDBFile, err))
+		}
+	}
+
+	romFile, err := openRom(fileName, *entry)
 	if err != nil {
 		panic(fmt.Errorf("error opening ROM file: %v - %v", fileName, err))
 	}
-	defer romFile.Close()
-	var rom *ines.INesRom
-	if rom, err = ines.NewINesRom(romFile); err != nil {
-		panic(err)
+	if *patchFile == "" {
+		*patchFile = patch.Find(fileName)
+	}
+	if *patchFile != "" {
+		if romFile.Data, err = patch.ApplyFile(romFile.Data, *patchFile); err != nil {
+			panic(fmt.Errorf("error patching ROM file: %v - %v", fileName, err))
+		}
+		logger.Infof("ROM patched with %v", *patchFile)
+	}
+	rom, err := parseRom(romFile, &ines.LoadOptions{NoDatabase: *noRomDB}, *fdsBios, config.DataDir)
+	if err != nil {
+		panic(fmt.Errorf("error loading ROM file: %v - %v", romFile.Name, err))
+	}
+	logger.Warnf("%s ROM file loaded: %v\n", rom.Format, rom)
+
+	nes := nes.NewNes(config)
+	if err := nes.LoadCartridge(rom); err != nil {
+		panic(fmt.Errorf("error loading cartridge: %v - %v", romFile.Name, err))
+	}
+	romChecksum := movie.RomChecksum(rom.PrgBin, rom.ChrBin)
+	if rom.Mapper == ines.MAPPER_FDS {
+		romChecksum = movie.RomChecksum(rom.Extra, nil)
 	}
-	logger.Warnf("iNES ROM file loaded: %v\n", rom)
+	var recording, playing *movie.Movie
+	if *recordMovie != "" {
+		recording = movie.NewMovie(filepath.Base(romFile.Name), romChecksum)
+		if err := nes.RecordMovie(recording); err != nil {
+			panic(err)
+		}
+	} else if *playMovie != "" {
+		if playing, err = loadMovie(*playMovie); err != nil {
+			panic(fmt.Errorf("error loading movie: %v - %v", *playMovie, err))
+		}
+		if !bytes.Equal(playing.RomChecksum, romChecksum) {
+			logger.Warnf("movie was recorded with another ROM: %v", playing.RomFilename)
+		}
+		if err := nes.PlayMovie(playing); err != nil {
+			panic(err)
+		}
+	}
+	if *headless {
+		if *frames <= 0 && playing != nil {
+			*frames = len(playing.Frames)
+		}
+		if err := runHeadless(nes, *frames); err != nil {
+			panic(err)
+		}
+	} else {
+		window, err := newWindow()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := nes.Start(window); err != nil {
+			panic(err)
+		}
+	}
+	movieErr := nes.StopMovie()
+	if recording != nil {
+		if err := saveMovie(*recordMovie, recording); err != nil {
+			panic(fmt.Errorf("error saving movie: %v - %v", *recordMovie, err))
+		}
+	}
+	if movieErr != nil {
+		fmt.Fprintln(os.Stderr, movieErr)
+		os.Exit(1)
+	}
+}
+
+// openRom reads the ROM file, extracting it from an archive,
+// and asks which ROM to load when the archive has several and no -entry is given.
+func openRom(fileName, entry string) (*archive.File, error) {
+	f, err := archive.Open(fileName, entry)
+	entryErr, ok := err.(*archive.EntryError)
+	if !ok || entry != "" || len(entryErr.Entries) == 0 || !isTerminal(os.Stdin) {
+		return f, err
+	}
+	fmt.Fprintf(os.Stderr, "%s has several ROMs:\n", fileName)
+	for i, name := range entryErr.Entries {
+		fmt.Fprintf(os.Stderr, "%3d. %s\n", i+1, name)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "ROM to load [1-%d]: ", len(entryErr.Entries))
+		var choice int
+		if _, err := fmt.Scanln(&choice); err == io.EOF {
+			return nil, entryErr
+		}
+		if choice >= 1 && choice <= len(entryErr.Entries) {
+			return archive.Open(fileName, entryErr.Entries[choice-1])
+		}
+	}
+}
+
+// parseRom hands the ROM file to the parser of its format.
+func parseRom(f *archive.File, options *ines.LoadOptions, fdsBios, dataDir string) (*cartridge.Cartridge, error) {
+	if bytes.HasPrefix(f.Data, []byte(unif.UNIF_FILE_MAGIC)) {
+		rom, err := unif.NewUnifRom(bytes.NewReader(f.Data))
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("UNIF ROM file loaded: %v", rom)
+		return rom.Cartridge()
+	}
+	switch ext := strings.ToLower(filepath.Ext(f.Name)); ext {
+	case ".fds", ".qd":
+		return parseDisk(f, fdsBios, dataDir)
+	case ".nsf":
+		return nil, fmt.Errorf("%s files are not supported yet", ext)
+	default:
+		if bytes.HasPrefix(f.Data, []byte(fds.FDS_FILE_MAGIC)) {
+			return parseDisk(f, fdsBios, dataDir)
+		}
+		rom, err := ines.NewINesRomWithOptions(bytes.NewReader(f.Data), options)
+		if err != nil {
+			return nil, err
+		}
+		return rom.Cartridge(), nil
+	}
+}
+
+// parseDisk reads a Famicom Disk System image, to run with the BIOS supplied by the user.
+func parseDisk(f *archive.File, biosFile, dataDir string) (*cartridge.Cartridge, error) {
+	image, err := fds.NewImage(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, err
+	}
+	if biosFile == "" {
+		if dataDir == "" {
+			if dataDir, err = datadir.Default(); err != nil {
+				return nil, err
+			}
+		}
+		biosFile = filepath.Join(dataDir, "disksys.rom")
+	}
+	bios, err := ioutil.ReadFile(biosFile)
+	if err != nil {
+		return nil, fmt.Errorf("the Famicom Disk System BIOS is required, give it with -fds-bios: %v", err)
+	}
+	logger.Infof("FDS disk loaded with %d sides, BIOS %v", len(image.Sides), biosFile)
+	return image.Cartridge(bios)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runHeadless(machine nes.NES, frames int) error {
+	if frames <= 0 {
+		return fmt.Errorf("-frames is required in headless mode unless a movie is played")
+	}
+	if err := machine.PowerOn(); err != nil {
+		return err
+	}
+	start := time.Now()
+	for i := 0; i < frames; i++ {
+		machine.RunFrame()
+	}
+	logger.Infof("emulated %d frames in %v", frames, time.Since(start))
+	return machine.Flush()
+}
+
+func loadMovie(fileName string) (*movie.Movie, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return movie.ReadFM2(f)
+}
+
+// loadRomDB adds the entries of an XML game database to the default ROM database.
+func loadRomDB(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := romdb.ParseXML(f)
+	if err != nil {
+		return err
+	}
+	romdb.Default.Add(entries)
+	logger.Infof("%d entries loaded from ROM database %v", len(entries), fileName)
+	return nil
+}
+
+func saveMovie(fileName string, m *movie.Movie) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := m.WriteFM2(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	nes := nes.NewNes()
-	nes.LoadCartridge(rom)
-	nes.Start()
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
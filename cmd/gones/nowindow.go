@@ -0,0 +1,14 @@
+//go:build nowindow
+// +build nowindow
+
+package main
+
+import (
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/nes"
+)
+
+// newWindow fails in binaries built with the nowindow tag, which don't link fyne, GLFW and X11.
+func newWindow() (nes.Frontend, error) {
+	return nil, fmt.Errorf("this gones is built without a window, run it with -headless")
+}
@@ -0,0 +1,14 @@
+//go:build !nowindow
+// +build !nowindow
+
+package main
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/frontend/window"
+	"github.com/vfreex/gones/pkg/emulator/nes"
+)
+
+// newWindow opens the fyne window, left out of binaries built with the nowindow tag.
+func newWindow() (nes.Frontend, error) {
+	return window.NewWindow(), nil
+}
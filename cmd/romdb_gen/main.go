@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/romdb"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var mirroringNames = map[romdb.Mirroring]string{
+	romdb.MIRRORING_HORIZONTAL:  "MIRRORING_HORIZONTAL",
+	romdb.MIRRORING_VERTICAL:    "MIRRORING_VERTICAL",
+	romdb.MIRRORING_FOUR_SCREEN: "MIRRORING_FOUR_SCREEN",
+	romdb.MIRRORING_MAPPER:      "MIRRORING_MAPPER",
+}
+
+var regionNames = map[region.Region]string{
+	region.REGION_NTSC:  "REGION_NTSC",
+	region.REGION_PAL:   "REGION_PAL",
+	region.REGION_DENDY: "REGION_DENDY",
+}
+
+// romdb_gen converts an XML game database into the entries embedded in the romdb package.
+func main() {
+	output := flag.String("o", "pkg/emulator/rom/romdb/entries.gen.go", "generated Go file")
+	flag.Parse()
+	input := "assets/romdb.xml"
+	if flag.NArg() > 0 {
+		input = flag.Arg(0)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	entries, err := romdb.ParseXML(file)
+	if err != nil {
+		panic(err)
+	}
+
+	entriesSrc := &bytes.Buffer{}
+	usesRegion := false
+	for _, entry := range entries {
+		fmt.Fprintf(entriesSrc, "{%s},\n", entryFields(entry))
+		usesRegion = usesRegion || entry.Region != region.REGION_AUTO
+	}
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by romdb_gen from %s. DO NOT EDIT.\n\n", input)
+	fmt.Fprintf(src, "package romdb\n\n")
+	if usesRegion {
+		fmt.Fprintf(src, "import \"github.com/vfreex/gones/pkg/emulator/region\"\n\n")
+	}
+	fmt.Fprintf(src, "var embeddedEntries = []Entry{\n%s}\n", entriesSrc.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(*output, formatted, 0644); err != nil {
+		panic(err)
+	}
+	fmt.Printf("generated %d entries into %s\n", len(entries), *output)
+}
+
+// entryFields writes the fields of an entry, leaving out the zero ones to keep the generated file small.
+func entryFields(entry romdb.Entry) string {
+	fields := []string{fmt.Sprintf("Name: %q", entry.Name), fmt.Sprintf("CRC32: 0x%08X", entry.CRC32)}
+	add := func(set bool, format string, args ...interface{}) {
+		if set {
+			fields = append(fields, fmt.Sprintf(format, args...))
+		}
+	}
+	add(entry.SHA1 != "", "SHA1: %q", entry.SHA1)
+	add(entry.Mapper != 0, "Mapper: %d", entry.Mapper)
+	add(entry.Submapper != 0, "Submapper: %d", entry.Submapper)
+	add(entry.Mirroring != romdb.MIRRORING_HORIZONTAL, "Mirroring: %s", mirroringNames[entry.Mirroring])
+	add(entry.Battery, "Battery: true")
+	add(entry.PrgRam != 0, "PrgRam: %d", entry.PrgRam)
+	add(entry.PrgNvram != 0, "PrgNvram: %d", entry.PrgNvram)
+	add(entry.ChrRam != 0, "ChrRam: %d", entry.ChrRam)
+	add(entry.ChrNvram != 0, "ChrNvram: %d", entry.ChrNvram)
+	add(entry.Region != region.REGION_AUTO, "Region: region.%s", regionNames[entry.Region])
+	return strings.Join(fields, ", ")
+}
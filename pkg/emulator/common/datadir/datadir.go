@@ -0,0 +1,39 @@
+package datadir
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const appName = "gones"
+
+// Default returns the per-user directory where GoNES keeps its data, like save states.
+func Default() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" && runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		return filepath.Join(dir, appName), nil
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, appName), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(home, "AppData", "Roaming", appName), nil
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", appName), nil
+	default:
+		return filepath.Join(home, ".local", "share", appName), nil
+	}
+}
+
+// RomDir returns the directory for the data of a ROM under base, e.g. base/states/<hash>.
+func RomDir(base, kind string, romHash []byte) string {
+	return filepath.Join(base, kind, hex.EncodeToString(romHash))
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type Logger interface {
@@ -41,6 +42,12 @@ func (l *ZapLogger) Debugf(msg string, args ...interface{}) {
 	//l.suger.Debugf(msg, args...)
 }
 
+// DebugEnabled reports whether debug messages are logged,
+// so callers can skip gathering expensive debug information.
+func (l *ZapLogger) DebugEnabled() bool {
+	return l.logger.Core().Enabled(zapcore.DebugLevel)
+}
+
 func (l *ZapLogger) Info(msg string) {
 	l.logger.Info(msg)
 }
@@ -25,12 +25,15 @@ type Cpu struct {
 	IRQ bool
 	// waitCycles
 	Wait int
+	// opcode fetches go through fetcher if memory distinguishes them from data reads
+	fetcher memory.OpcodeFetcher
 }
 
 var logger = logger2.GetLogger()
 
-func NewCpu(memory memory.Memory) *Cpu {
-	cpu := &Cpu{Memory: memory}
+func NewCpu(mem memory.Memory) *Cpu {
+	cpu := &Cpu{Memory: mem}
+	cpu.fetcher, _ = mem.(memory.OpcodeFetcher)
 	return cpu
 }
 
@@ -88,8 +91,10 @@ func (cpu *Cpu) ExecOneInstruction() (cycles int) {
 	} else if cpu.IRQ && cpu.P&PFLAG_I == 0 {
 		cpu.ExecIRQ()
 	}
-	cpu.logInstruction()
-	opcode := cpu.Memory.Peek(cpu.PC)
+	if logger.DebugEnabled() {
+		cpu.logInstruction()
+	}
+	opcode := cpu.fetchOpcode()
 	handler := opcodeHandlers[opcode]
 	if handler == nil {
 		logger.Fatalf("opcode %02x is not supported", opcode)
@@ -106,6 +111,13 @@ func (cpu *Cpu) ExecOneInstruction() (cycles int) {
 	return 1 + cycles1 + cycles2 + wait
 }
 
+func (cpu *Cpu) fetchOpcode() byte {
+	if cpu.fetcher != nil {
+		return cpu.fetcher.Fetch(cpu.PC)
+	}
+	return cpu.Memory.Peek(cpu.PC)
+}
+
 func (cpu *Cpu) logInstruction() {
 	opcode := cpu.Memory.Peek(cpu.PC)
 	info := &InstructionInfos[opcode]
@@ -0,0 +1,34 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type cpuState struct {
+	PC       ProgramCounter
+	P        ProcessorStatus
+	SP       StackPointer
+	A        Accumulator
+	X, Y     IndexRegister
+	NMI, IRQ bool
+	Wait     int32
+}
+
+func (cpu *Cpu) SaveState(w io.Writer) error {
+	state := cpuState{
+		PC: cpu.PC, P: cpu.P, SP: cpu.SP, A: cpu.A, X: cpu.X, Y: cpu.Y,
+		NMI: cpu.NMI, IRQ: cpu.IRQ, Wait: int32(cpu.Wait),
+	}
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (cpu *Cpu) LoadState(r io.Reader) error {
+	var state cpuState
+	if err := binary.Read(r, binary.LittleEndian, &state); err != nil {
+		return err
+	}
+	cpu.PC, cpu.P, cpu.SP, cpu.A, cpu.X, cpu.Y = state.PC, state.P, state.SP, state.A, state.X, state.Y
+	cpu.NMI, cpu.IRQ, cpu.Wait = state.NMI, state.IRQ, int(state.Wait)
+	return nil
+}
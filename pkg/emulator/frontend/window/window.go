@@ -0,0 +1,357 @@
+// Package window is a desktop frontend of the emulator, drawing in a fyne window.
+package window
+
+import (
+	"fmt"
+	"fyne.io/fyne"
+	"fyne.io/fyne/app"
+	"fyne.io/fyne/canvas"
+	"fyne.io/fyne/driver/desktop"
+	"fyne.io/fyne/widget"
+	pkgLogger "github.com/vfreex/gones/pkg/emulator/common/logger"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"github.com/vfreex/gones/pkg/emulator/nes"
+	"github.com/vfreex/gones/pkg/emulator/ppu"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+var logger = pkgLogger.GetLogger()
+
+// Window is the fyne frontend, with buttons to control the emulation and manage quick-save slots.
+type Window struct {
+	app          fyne.App
+	mainWindow   fyne.Window
+	raster       *canvas.Raster
+	canvasObj    fyne.CanvasObject
+	commands     chan nes.Command
+	PressedKeys  byte
+	ReleasedKeys byte
+	img          *image.RGBA
+	slotLabel    *widget.Label
+	thumbnail    *canvas.Raster
+	shiftPressed bool
+	// guards the fields below, shared by the UI and the emulation goroutines
+	lock   sync.Mutex
+	frames *nes.FrameBuffer
+	keys   byte
+	// set while the rewind key is held
+	rewinding bool
+	slot      int
+	slots     *nes.SaveSlots
+	// thumbnail of the current slot, nil if the slot is empty
+	thumbnailImg image.Image
+}
+
+var slotKeys = [nes.SAVE_SLOTS]fyne.KeyName{
+	fyne.KeyF1, fyne.KeyF2, fyne.KeyF3, fyne.KeyF4, fyne.KeyF5,
+	fyne.KeyF6, fyne.KeyF7, fyne.KeyF8, fyne.KeyF9, fyne.KeyF10,
+}
+
+var rnd = rand.New(rand.NewSource(time.Now().Unix()))
+var temp = int(0)
+
+func NewWindow() *Window {
+	app := app.New()
+	mainWindow := app.NewWindow("GoNES")
+	display := &Window{
+		app:        app,
+		mainWindow: mainWindow,
+		commands:   make(chan nes.Command, 16),
+		slot:       1,
+		slotLabel:  widget.NewLabel(""),
+	}
+	display.thumbnail = canvas.NewRaster(display.drawThumbnail)
+	display.thumbnail.SetMinSize(fyne.NewSize(nes.THUMBNAIL_WIDTH/2, nes.THUMBNAIL_HEIGHT/2))
+	display.SelectSlot(1)
+	gameCanvas := display.render()
+	mainWindow.SetContent(
+		widget.NewVBox(gameCanvas,
+			widget.NewHBox(
+				widget.NewButton(">", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_STEP_INSTRUCTION})
+				}),
+				widget.NewButton(">>", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_STEP_FRAME})
+				}),
+				widget.NewButton("||", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_PAUSE})
+				}),
+				widget.NewButton("->", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_RESUME})
+				}),
+				widget.NewButton("RESET", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_RESET})
+				}),
+				widget.NewButton("POWER", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_POWER_CYCLE})
+				}),
+				widget.NewButton("DISK", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_INSERT_EJECT_DISK})
+				}),
+				widget.NewButton("SIDE", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_SELECT_DISK_SIDE})
+				}),
+				widget.NewButton("SLOT-", func() {
+					display.SelectSlot((display.currentSlot()+nes.SAVE_SLOTS-2)%nes.SAVE_SLOTS + 1)
+				}),
+				display.slotLabel,
+				widget.NewButton("SLOT+", func() {
+					display.SelectSlot(display.currentSlot()%nes.SAVE_SLOTS + 1)
+				}),
+				widget.NewButton("SAVE", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_SAVE_SLOT, Slot: display.currentSlot()})
+				}),
+				widget.NewButton("LOAD", func() {
+					display.send(nes.Command{Kind: nes.COMMAND_LOAD_SLOT, Slot: display.currentSlot()})
+				}),
+				display.thumbnail,
+			),
+		))
+	mainWindow.Canvas().(desktop.Canvas).SetOnKeyDown(func(event *fyne.KeyEvent) {
+		// F1-F10 load a quick-save slot, Shift+F1-F10 save into it
+		for i, key := range slotKeys {
+			if event.Name == key {
+				display.SelectSlot(i + 1)
+				if display.shiftPressed {
+					display.send(nes.Command{Kind: nes.COMMAND_SAVE_SLOT, Slot: i + 1})
+				} else {
+					display.send(nes.Command{Kind: nes.COMMAND_LOAD_SLOT, Slot: i + 1})
+				}
+				return
+			}
+		}
+		switch event.Name {
+		case fyne.KeyEscape:
+			display.send(nes.Command{Kind: nes.COMMAND_QUIT})
+		case fyne.KeyBackspace:
+			display.setRewinding(true)
+		case desktop.KeyShiftLeft:
+			fallthrough
+		case desktop.KeyShiftRight:
+			display.shiftPressed = true
+		case fyne.KeyReturn:
+			display.press(joypad.Button_Start)
+		case fyne.KeyA:
+			fallthrough
+		case fyne.KeyLeft:
+			display.press(joypad.Button_Left)
+		case fyne.KeyW:
+			fallthrough
+		case fyne.KeyUp:
+			display.press(joypad.Button_Up)
+		case fyne.KeyD:
+			fallthrough
+		case fyne.KeyRight:
+			display.press(joypad.Button_Right)
+		case fyne.KeyS:
+			fallthrough
+		case fyne.KeyDown:
+			display.press(joypad.Button_Down)
+		case fyne.KeyZ:
+			display.press(joypad.Button_B)
+		case fyne.KeyX:
+			display.press(joypad.Button_A)
+		case fyne.KeyTab:
+			fallthrough
+		case "LeftControl":
+			fallthrough
+		case "RightControl":
+			display.press(joypad.Button_Select)
+		}
+	})
+	mainWindow.Canvas().(desktop.Canvas).SetOnKeyUp(func(event *fyne.KeyEvent) {
+		switch event.Name {
+		case fyne.KeyBackspace:
+			display.setRewinding(false)
+		case desktop.KeyShiftLeft:
+			fallthrough
+		case desktop.KeyShiftRight:
+			display.shiftPressed = false
+		case fyne.KeyReturn:
+			display.release(joypad.Button_Start)
+		case fyne.KeyA:
+			fallthrough
+		case fyne.KeyLeft:
+			display.release(joypad.Button_Left)
+		case fyne.KeyW:
+			fallthrough
+		case fyne.KeyUp:
+			display.release(joypad.Button_Up)
+		case fyne.KeyD:
+			fallthrough
+		case fyne.KeyRight:
+			display.release(joypad.Button_Right)
+		case fyne.KeyS:
+			fallthrough
+		case fyne.KeyDown:
+			display.release(joypad.Button_Down)
+		case fyne.KeyZ:
+			display.release(joypad.Button_B)
+		case fyne.KeyX:
+			display.release(joypad.Button_A)
+		case fyne.KeyTab:
+			fallthrough
+		case "LeftControl":
+			fallthrough
+		case "RightControl":
+			display.release(joypad.Button_Select)
+		}
+	})
+	mainWindow.SetFixedSize(true)
+	return display
+}
+
+func (p *Window) render() fyne.CanvasObject {
+	//p.update()
+	lastW, lastH := 0, 0
+	p.raster = canvas.NewRaster(func(w, h int) image.Image {
+		if p.img == nil || w != lastW || h != lastH {
+			p.img = image.NewRGBA(image.Rect(0, 0, w, h))
+			lastW = w
+			lastH = h
+		}
+		p.lock.Lock()
+		frames := p.frames
+		p.lock.Unlock()
+		if frames == nil {
+			return p.img
+		}
+		frames.Read(func(screenPixels *[nes.SCREEN_HEIGHT][nes.SCREEN_WIDTH]ppu.RBGColor) {
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					pixel := screenPixels[y*nes.SCREEN_HEIGHT/h][x*nes.SCREEN_WIDTH/w]
+					p.img.SetRGBA(x, y, color.RGBA{R: byte(pixel >> 16), G: byte(pixel >> 8), B: byte(pixel >> 0), A: 0xff})
+				}
+			}
+		})
+		return p.img
+	})
+	p.raster.SetMinSize(fyne.NewSize(nes.SCREEN_WIDTH*2, nes.SCREEN_HEIGHT*2))
+	p.canvasObj = p.raster
+	return p.canvasObj
+}
+
+func (p *Window) Run() error {
+	p.mainWindow.ShowAndRun()
+	return nil
+}
+
+func (p *Window) Quit() {
+	p.app.Quit()
+}
+
+func (p *Window) PresentFrame(frames *nes.FrameBuffer) {
+	p.lock.Lock()
+	p.frames = frames
+	p.lock.Unlock()
+	//temp += 0x100000
+	p.mainWindow.Canvas().Refresh(p.canvasObj)
+}
+
+func (p *Window) PollInput() nes.Input {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return nes.Input{Joypads: joypad.Input{p.keys, 0}, Rewind: p.rewinding}
+}
+
+func (p *Window) press(button byte) {
+	p.lock.Lock()
+	p.keys |= button
+	p.lock.Unlock()
+}
+
+func (p *Window) release(button byte) {
+	p.lock.Lock()
+	p.keys &^= button
+	p.lock.Unlock()
+}
+
+func (p *Window) setRewinding(rewinding bool) {
+	p.lock.Lock()
+	p.rewinding = rewinding
+	p.lock.Unlock()
+}
+
+func (p *Window) currentSlot() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.slot
+}
+
+func (p *Window) Commands() <-chan nes.Command {
+	return p.commands
+}
+
+// send queues a command, dropping it if the emulation doesn't keep up.
+func (p *Window) send(command nes.Command) {
+	select {
+	case p.commands <- command:
+	default:
+		logger.Warnf("dropping command %v, the emulation is not responding", command.Kind)
+	}
+}
+
+func (p *Window) OutputAudio(samples []float32) {
+	// no audio output yet
+}
+
+func (p *Window) SetSaveSlots(slots *nes.SaveSlots) {
+	p.lock.Lock()
+	p.slots = slots
+	p.lock.Unlock()
+	p.RefreshThumbnail()
+}
+
+// SelectSlot makes the slot current for the SAVE and LOAD buttons and shows its thumbnail.
+func (p *Window) SelectSlot(slot int) {
+	p.lock.Lock()
+	p.slot = slot
+	p.lock.Unlock()
+	p.slotLabel.SetText(fmt.Sprintf("SLOT %d", slot))
+	p.RefreshThumbnail()
+}
+
+// RefreshThumbnail shows the thumbnail of the current slot, or nothing if the slot is empty.
+// It is called from the emulation goroutine as well, leaving the drawing to the UI in drawThumbnail.
+func (p *Window) RefreshThumbnail() {
+	p.lock.Lock()
+	slot, slots := p.slot, p.slots
+	p.lock.Unlock()
+	var img image.Image
+	if slots != nil && slots.HasState(slot) {
+		if f, err := os.Open(slots.ThumbnailPath(slot)); err == nil {
+			img, _ = png.Decode(f)
+			f.Close()
+		}
+	}
+	p.lock.Lock()
+	if p.slot != slot {
+		// another slot was selected meanwhile, its own refresh shows its thumbnail
+		p.lock.Unlock()
+		return
+	}
+	p.thumbnailImg = img
+	p.lock.Unlock()
+	canvas.Refresh(p.thumbnail)
+}
+
+func (p *Window) drawThumbnail(w, h int) image.Image {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.thumbnailImg == nil {
+		return image.NewUniform(color.Transparent)
+	}
+	return p.thumbnailImg
+}
+
+func (p *Window) SlotSaved(slot int) {
+	if slot == p.currentSlot() {
+		p.RefreshThumbnail()
+	}
+}
@@ -36,10 +36,22 @@ type Joypads struct {
 	Reset   bool
 }
 
+// Input is the state of the buttons of both joypads during a frame.
+type Input [2]byte
+
 func NewJoypads() *Joypads {
 	return &Joypads{}
 }
 
+func (p *Joypads) Input() Input {
+	return Input{p.Joypads[0].Buttons, p.Joypads[1].Buttons}
+}
+
+func (p *Joypads) SetInput(input Input) {
+	p.Joypads[0].Buttons = input[0]
+	p.Joypads[1].Buttons = input[1]
+}
+
 func (p *Joypads) getJoypad(addr memory.Ptr) *Joypad {
 	var joypad *Joypad
 	switch addr {
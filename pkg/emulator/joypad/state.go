@@ -0,0 +1,14 @@
+package joypad
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+func (p *Joypads) SaveState(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, p)
+}
+
+func (p *Joypads) LoadState(r io.Reader) error {
+	return binary.Read(r, binary.LittleEndian, p)
+}
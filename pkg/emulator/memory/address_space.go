@@ -2,15 +2,23 @@ package memory
 
 import (
 	"fmt"
+	pkgLogger "github.com/vfreex/gones/pkg/emulator/common/logger"
 	"sort"
 )
 
+var logger = pkgLogger.GetLogger()
+
 type AddressSpace interface {
 	Memory
 	Map()
-	AddMapping(offset Ptr, length PtrDist, mode MMapMode, mappedMemory Memory, translator AddressTranslator)
+	AddMapping(offset Ptr, length PtrDist, mode MMapMode, mappedMemory Memory, translator AddressTranslator) MappingID
+	RemoveMapping(id MappingID)
+	ReplaceMapping(id MappingID, mode MMapMode, mappedMemory Memory, translator AddressTranslator)
 }
 
+// MappingID is a handle to a mapping, which can be used to remove or replace it at runtime.
+type MappingID int
+
 type AddressTranslator func(addr Ptr) Ptr
 
 type MMapMode uint
@@ -21,7 +29,19 @@ const (
 	MMAP_MODE_EXEC
 )
 
+// The 16-bit address space is decoded through a flat table of 256-byte pages.
+// A page is either covered by a single mapping, or split between several small mappings
+// (e.g. the CPU I/O registers at $4000-$401F), in which case it gets a per-address table.
+// Mapped Memory implementations such as mappers switch banks internally,
+// so bank switching never requires rebuilding the page table.
+const (
+	pageShift = 8
+	pageSize  = 1 << pageShift
+	pageCount = 0x10000 >> pageShift
+)
+
 type MMapEntry struct {
+	id         MappingID
 	Offset     Ptr
 	Length     PtrDist
 	Mode       MMapMode
@@ -45,50 +65,186 @@ func (p MMapEntries) Swap(i, j int) {
 	[]MMapEntry(p)[j] = t
 }
 
+type pageTableEntry struct {
+	// mapping covering the whole page
+	entry *MMapEntry
+	// per-address mappings for a page shared by several mappings
+	split *[pageSize]*MMapEntry
+	// kinds of accesses watched somewhere in this page
+	watched AccessKind
+}
+
 type AddressSpaceImpl struct {
-	mMapEntries MMapEntries
+	mMapEntries   MMapEntries
+	pageTable     [pageCount]pageTableEntry
+	watchpoints   watchpoints
+	nextMappingID MappingID
+	// set once Map() is called, after which changing mappings takes effect immediately
+	mapped bool
+	// set once an opcode was fetched from outside executable memory, logged only the first time
+	execFaulted bool
 }
 
-func (as *AddressSpaceImpl) AddMapping(offset Ptr, length PtrDist, mode MMapMode, mappedMemory Memory, translator AddressTranslator) {
+func (as *AddressSpaceImpl) AddMapping(offset Ptr, length PtrDist, mode MMapMode, mappedMemory Memory, translator AddressTranslator) MappingID {
+	as.nextMappingID++
 	as.mMapEntries = append(as.mMapEntries, MMapEntry{
+		id:         as.nextMappingID,
 		Offset:     offset,
 		Length:     length,
 		Mode:       mode,
 		Memory:     mappedMemory,
 		Translator: translator,
 	})
+	as.remap()
+	return as.nextMappingID
+}
+
+func (as *AddressSpaceImpl) findMapping(id MappingID) int {
+	for i := range as.mMapEntries {
+		if as.mMapEntries[i].id == id {
+			return i
+		}
+	}
+	panic(fmt.Errorf("mapping #%d doesn't exist", id))
+}
+
+func (as *AddressSpaceImpl) RemoveMapping(id MappingID) {
+	i := as.findMapping(id)
+	as.mMapEntries = append(as.mMapEntries[:i:i], as.mMapEntries[i+1:]...)
+	as.remap()
+}
+
+// ReplaceMapping points an existing mapping to another memory, keeping its address range.
+func (as *AddressSpaceImpl) ReplaceMapping(id MappingID, mode MMapMode, mappedMemory Memory, translator AddressTranslator) {
+	entry := &as.mMapEntries[as.findMapping(id)]
+	entry.Mode = mode
+	entry.Memory = mappedMemory
+	entry.Translator = translator
 }
 
+func (as *AddressSpaceImpl) remap() {
+	if as.mapped {
+		as.Map()
+	}
+}
+
+// Map builds the page table from the added mappings.
+// Mappings added, removed or replaced afterwards take effect immediately.
+// Where mappings overlap, the one with the higher offset wins over the whole overlap,
+// and the lower one still answers past its end (the binary search decoder used before
+// reported those addresses unmapped). Of mappings with the same offset, the one added last wins.
 func (as *AddressSpaceImpl) Map() {
-	sort.Sort(as.mMapEntries)
+	as.mapped = true
+	sort.Stable(as.mMapEntries)
+	as.pageTable = [pageCount]pageTableEntry{}
+	as.updateWatchedPages()
+	// mappings with higher offsets take precedence over overlapping lower ones
+	for i := range as.mMapEntries {
+		entry := &as.mMapEntries[i]
+		start := int(entry.Offset)
+		end := start + int(entry.Length)
+		if end > 0x10000 {
+			panic(fmt.Errorf("mapping at 0x%x with length 0x%x exceeds the address space", entry.Offset, entry.Length))
+		}
+		for addr := start; addr < end; {
+			pte := &as.pageTable[addr>>pageShift]
+			pageStart := addr &^ (pageSize - 1)
+			if addr == pageStart && end-addr >= pageSize {
+				// the whole page is covered by this mapping
+				pte.entry = entry
+				pte.split = nil
+				addr += pageSize
+				continue
+			}
+			if pte.split == nil {
+				pte.split = &[pageSize]*MMapEntry{}
+				if pte.entry != nil {
+					for j := range pte.split {
+						pte.split[j] = pte.entry
+					}
+					pte.entry = nil
+				}
+			}
+			for ; addr < end && addr < pageStart+pageSize; addr++ {
+				pte.split[addr&(pageSize-1)] = entry
+			}
+		}
+	}
 }
 
-func (as *AddressSpaceImpl) lookupMappedMemory(addr Ptr) (*MMapEntry, Ptr) {
-	index := sort.Search(len(as.mMapEntries), func(i int) bool {
-		return as.mMapEntries[i].Offset > addr
-	}) - 1
-	if index < 0 || int(addr)-int(as.mMapEntries[index].Offset) >= int(as.mMapEntries[index].Length) {
-		panic(fmt.Errorf("trying to access unmapped address 0x%x", addr))
+// lookup returns the mapping of an address, nil if it is unmapped, and the accesses watched in its page.
+func (as *AddressSpaceImpl) lookup(addr Ptr) (*MMapEntry, AccessKind) {
+	pte := &as.pageTable[addr>>pageShift]
+	entry := pte.entry
+	if entry == nil && pte.split != nil {
+		entry = pte.split[addr&(pageSize-1)]
 	}
-	mappedAddr := addr
-	if as.mMapEntries[index].Translator != nil {
-		mappedAddr = as.mMapEntries[index].Translator(addr)
+	return entry, pte.watched
+}
+
+func (entry *MMapEntry) translate(addr Ptr) Ptr {
+	if entry.Translator != nil {
+		return entry.Translator(addr)
 	}
-	return &as.mMapEntries[index], mappedAddr
+	return addr
+}
+
+func (as *AddressSpaceImpl) lookupMappedMemory(addr Ptr) (*MMapEntry, Ptr, AccessKind) {
+	entry, watched := as.lookup(addr)
+	if entry == nil {
+		panic(fmt.Errorf("trying to access unmapped address 0x%x", addr))
+	}
+	return entry, entry.translate(addr), watched
 }
 
 func (as *AddressSpaceImpl) Peek(addr Ptr) byte {
-	entry, mappedAddr := as.lookupMappedMemory(addr)
+	entry, mappedAddr, watched := as.lookupMappedMemory(addr)
 	if entry.Mode&MMAP_MODE_READ == 0 {
 		panic(fmt.Errorf("permission denied when trying to read 0x%x", addr))
 	}
-	return entry.Memory.Peek(mappedAddr)
+	val := entry.Memory.Peek(mappedAddr)
+	if watched&ACCESS_READ != 0 {
+		as.watchpoints.notify(Access{Kind: ACCESS_READ, Addr: addr, Value: val})
+	}
+	return val
 }
 
 func (as *AddressSpaceImpl) Poke(addr Ptr, val byte) {
-	entry, mappedAddr := as.lookupMappedMemory(addr)
+	entry, mappedAddr, watched := as.lookupMappedMemory(addr)
 	if entry.Mode&MMAP_MODE_WRITE == 0 {
 		panic(fmt.Errorf("permission denied when trying to write %x", addr))
 	}
 	entry.Memory.Poke(mappedAddr, val)
+	if watched&ACCESS_WRITE != 0 {
+		as.watchpoints.notify(Access{Kind: ACCESS_WRITE, Addr: addr, Value: val})
+	}
+}
+
+// Fetch reads an opcode for execution.
+// Programs jumping outside MMAP_MODE_EXEC mappings, like test ROMs running code from I/O registers,
+// read the memory there or the open bus if nothing is mapped, as the CPU does; the fault is only logged.
+func (as *AddressSpaceImpl) Fetch(addr Ptr) byte {
+	entry, watched := as.lookup(addr)
+	if entry == nil || entry.Mode&MMAP_MODE_EXEC == 0 {
+		as.execFault(addr)
+	}
+	var val byte
+	if entry != nil {
+		val = entry.Memory.Peek(entry.translate(addr))
+	} else {
+		// the high byte of the address, left on the bus by the last operand read
+		val = byte(addr >> 8)
+	}
+	if watched&ACCESS_EXEC != 0 {
+		as.watchpoints.notify(Access{Kind: ACCESS_EXEC, Addr: addr, Value: val})
+	}
+	return val
+}
+
+func (as *AddressSpaceImpl) execFault(addr Ptr) {
+	if as.execFaulted {
+		return
+	}
+	as.execFaulted = true
+	logger.Warnf("executing 0x%x outside executable memory, further occurrences aren't logged", addr)
 }
@@ -0,0 +1,330 @@
+package memory_test
+
+import (
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/cpu"
+	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/ppu"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"sort"
+	"testing"
+)
+
+func TestAddressSpaceLookup(t *testing.T) {
+	as := &memory.AddressSpaceImpl{}
+	mainRam := ram.NewMainRAM()
+	io := ram.NewRAM(0x14)
+	port := ram.NewRAM(1)
+	as.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, mainRam, nil)
+	as.AddMapping(0x4015, 1, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, port, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x4015
+	})
+	as.AddMapping(0x4000, 0x14, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, io, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x4000
+	})
+	as.Map()
+
+	as.Poke(0x0812, 0x42)
+	if v := mainRam.Peek(0x12); v != 0x42 {
+		t.Errorf("expected mirrored RAM write 0x42, got 0x%02x", v)
+	}
+	as.Poke(0x4013, 0x13)
+	if v := io.Peek(0x13); v != 0x13 {
+		t.Errorf("expected I/O write 0x13, got 0x%02x", v)
+	}
+	as.Poke(0x4015, 0x15)
+	if v := port.Peek(0); v != 0x15 {
+		t.Errorf("expected port write 0x15, got 0x%02x", v)
+	}
+	for _, addr := range []memory.Ptr{0x2000, 0x4016, 0x40ff, 0xffff} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected access to unmapped address 0x%04x to panic", addr)
+				}
+			}()
+			as.Peek(addr)
+		}()
+	}
+}
+
+// sortedAddressSpace is the binary search address decoder the page table replaced,
+// kept to compare the performance of both.
+type sortedAddressSpace struct {
+	entries memory.MMapEntries
+}
+
+func (as *sortedAddressSpace) AddMapping(offset memory.Ptr, length memory.PtrDist, mode memory.MMapMode, mappedMemory memory.Memory, translator memory.AddressTranslator) memory.MappingID {
+	as.entries = append(as.entries, memory.MMapEntry{
+		Offset: offset, Length: length, Mode: mode, Memory: mappedMemory, Translator: translator,
+	})
+	return memory.MappingID(len(as.entries))
+}
+
+func (as *sortedAddressSpace) RemoveMapping(id memory.MappingID) {
+	panic("not supported")
+}
+
+func (as *sortedAddressSpace) ReplaceMapping(id memory.MappingID, mode memory.MMapMode, mappedMemory memory.Memory, translator memory.AddressTranslator) {
+	panic("not supported")
+}
+
+func (as *sortedAddressSpace) Map() {
+	sort.Sort(as.entries)
+}
+
+func (as *sortedAddressSpace) lookup(addr memory.Ptr) (*memory.MMapEntry, memory.Ptr) {
+	index := sort.Search(len(as.entries), func(i int) bool {
+		return as.entries[i].Offset > addr
+	}) - 1
+	if index < 0 || int(addr)-int(as.entries[index].Offset) >= int(as.entries[index].Length) {
+		panic(fmt.Errorf("trying to access unmapped address 0x%x", addr))
+	}
+	mappedAddr := addr
+	if as.entries[index].Translator != nil {
+		mappedAddr = as.entries[index].Translator(addr)
+	}
+	return &as.entries[index], mappedAddr
+}
+
+func (as *sortedAddressSpace) Peek(addr memory.Ptr) byte {
+	entry, mappedAddr := as.lookup(addr)
+	return entry.Memory.Peek(mappedAddr)
+}
+
+func (as *sortedAddressSpace) Poke(addr memory.Ptr, val byte) {
+	entry, mappedAddr := as.lookup(addr)
+	entry.Memory.Poke(mappedAddr, val)
+}
+
+type prgRom [0x8000]byte
+
+func (p *prgRom) Peek(addr memory.Ptr) byte {
+	return p[addr&0x7fff]
+}
+
+func (p *prgRom) Poke(addr memory.Ptr, val byte) {
+}
+
+// turns rendering on, then runs a busy loop copying a RAM page and polling PPUSTATUS, like a typical game waiting for VBlank
+var benchmarkProgram = []byte{
+	0xa9, 0x1e, // LDA #$1E
+	0x8d, 0x01, 0x20, // STA $2001
+	0xa2, 0x00, // LDX #$00
+	0xbd, 0x00, 0x02, // LDA $0200,X
+	0x9d, 0x00, 0x03, // STA $0300,X
+	0xe8,       // INX
+	0xd0, 0xf7, // BNE $8007
+	0xad, 0x02, 0x20, // LDA $2002
+	0x4c, 0x05, 0x80, // JMP $8005
+}
+
+// benchmarkFrame emulates frames with rendering on. Both decoders run a frame in about the same time:
+// address decoding takes little more than a tenth of a frame, dominated by PPU.Step and drawPixel,
+// so the faster lookup of the page table measured by benchmarkPeek doesn't show at this scale.
+func benchmarkFrame(b *testing.B, newAddressSpace func() memory.AddressSpace) {
+	cpuAS := newAddressSpace()
+	ppuAS := newAddressSpace()
+	c := cpu.NewCpu(cpuAS)
+	p := ppu.NewPPU(ppuAS, c)
+
+	prg := &prgRom{}
+	copy(prg[:], benchmarkProgram)
+	for _, vector := range []int{0x7ffa, 0x7ffc, 0x7ffe} {
+		prg[vector] = 0x00
+		prg[vector+1] = 0x80
+	}
+	cpuAS.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, ram.NewMainRAM(), nil)
+	p.MapToCPUAddressSpace(cpuAS)
+	cpuAS.AddMapping(0x4000, 0x14, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
+		ram.NewRAM(0x14), func(addr memory.Ptr) memory.Ptr {
+			return addr - 0x4000
+		})
+	cpuAS.AddMapping(0x8000, 0x8000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE|memory.MMAP_MODE_EXEC, prg, nil)
+	ppuAS.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, ram.NewRAM(0x2000), nil)
+	ppuAS.AddMapping(0x2000, 0x1f00, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, ram.NewCIRam(), nil)
+	ppuAS.AddMapping(0x3F00, 0x100, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, &p.Palette, nil)
+	cpuAS.Map()
+	ppuAS.Map()
+	c.PowerUp()
+
+	const cpuCyclesPerFrame = 29780
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for spentCycles := 0; spentCycles < cpuCyclesPerFrame; {
+			cycles := c.ExecOneInstruction()
+			for pp := 0; pp < cycles*3; pp++ {
+				p.Step()
+			}
+			spentCycles += cycles
+		}
+	}
+}
+
+func BenchmarkFrame_PageTable(b *testing.B) {
+	benchmarkFrame(b, func() memory.AddressSpace {
+		return &memory.AddressSpaceImpl{}
+	})
+}
+
+func BenchmarkFrame_SortedSearch(b *testing.B) {
+	benchmarkFrame(b, func() memory.AddressSpace {
+		return &sortedAddressSpace{}
+	})
+}
+
+func benchmarkPeek(b *testing.B, as memory.AddressSpace) {
+	as.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, ram.NewMainRAM(), nil)
+	as.AddMapping(0x4000, 0x14, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
+		ram.NewRAM(0x14), func(addr memory.Ptr) memory.Ptr {
+			return addr - 0x4000
+		})
+	as.AddMapping(0x4015, 1, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
+		ram.NewRAM(1), func(addr memory.Ptr) memory.Ptr {
+			return addr - 0x4015
+		})
+	as.AddMapping(0x8000, 0x8000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, &prgRom{}, nil)
+	as.Map()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		as.Peek(memory.Ptr(0x8000 | i&0x7fff))
+		as.Peek(memory.Ptr(i & 0x7ff))
+	}
+}
+
+func BenchmarkPeek_PageTable(b *testing.B) {
+	benchmarkPeek(b, &memory.AddressSpaceImpl{})
+}
+
+func BenchmarkPeek_SortedSearch(b *testing.B) {
+	benchmarkPeek(b, &sortedAddressSpace{})
+}
+
+func TestWatchpoints(t *testing.T) {
+	as := &memory.AddressSpaceImpl{}
+	as.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE|memory.MMAP_MODE_EXEC, ram.NewMainRAM(), nil)
+	as.Map()
+
+	var accesses []memory.Access
+	id := as.AddWatchpoint(memory.Watchpoint{
+		Start: 0x40, End: 0x40, Kind: memory.ACCESS_WRITE, MatchValue: true, Value: 0,
+		Handler: func(access memory.Access) {
+			accesses = append(accesses, access)
+		},
+	})
+	as.AddWatchpoint(memory.Watchpoint{
+		Start: 0x0100, End: 0x01ff, Kind: memory.ACCESS_READ | memory.ACCESS_EXEC,
+		Handler: func(access memory.Access) {
+			accesses = append(accesses, access)
+		},
+	})
+	as.Poke(0x40, 1)
+	as.Poke(0x40, 0)
+	as.Poke(0x41, 0)
+	as.Peek(0x40)
+	as.Peek(0x0180)
+	as.Fetch(0x01ff)
+	as.Fetch(0x0200)
+	expected := []memory.Access{
+		{Kind: memory.ACCESS_WRITE, Addr: 0x40, Value: 0},
+		{Kind: memory.ACCESS_READ, Addr: 0x0180, Value: 0},
+		{Kind: memory.ACCESS_EXEC, Addr: 0x01ff, Value: 0},
+	}
+	if fmt.Sprint(accesses) != fmt.Sprint(expected) {
+		t.Fatalf("expected accesses %v, got %v", expected, accesses)
+	}
+
+	as.RemoveWatchpoint(id)
+	accesses = nil
+	as.Poke(0x40, 0)
+	if len(accesses) != 0 {
+		t.Fatalf("expected no accesses after removing the watchpoint, got %v", accesses)
+	}
+}
+
+func TestExecPermission(t *testing.T) {
+	as := &memory.AddressSpaceImpl{}
+	mainRam := ram.NewMainRAM()
+	mainRam.Poke(0x10, 0xea)
+	as.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, mainRam, nil)
+	as.Map()
+	var fetched []memory.Ptr
+	as.AddWatchpoint(memory.Watchpoint{
+		Start: 0, End: 0xffff, Kind: memory.ACCESS_EXEC,
+		Handler: func(access memory.Access) {
+			fetched = append(fetched, access.Addr)
+		},
+	})
+	// executing a non-executable mapping or the open bus doesn't stop the emulation
+	if v := as.Fetch(0x10); v != 0xea {
+		t.Errorf("expected the non-executable memory to be fetched, got 0x%02x", v)
+	}
+	if v := as.Fetch(0x5000); v != 0x50 {
+		t.Errorf("expected the open bus fetched from an unmapped address, got 0x%02x", v)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("expected the exec watchpoint to fire for both fetches, got %v", fetched)
+	}
+}
+
+func TestRuntimeRemapping(t *testing.T) {
+	as := &memory.AddressSpaceImpl{}
+	low := ram.NewRAM(0x100)
+	high := ram.NewRAM(0x100)
+	low.Poke(0x10, 1)
+	high.Poke(0x10, 2)
+	as.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, ram.NewMainRAM(), nil)
+	id := as.AddMapping(0x6000, 0x100, memory.MMAP_MODE_READ, low, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x6000
+	})
+	as.Map()
+	if v := as.Peek(0x6010); v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+
+	as.ReplaceMapping(id, memory.MMAP_MODE_READ, high, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x6000
+	})
+	if v := as.Peek(0x6010); v != 2 {
+		t.Fatalf("expected 2 after replacing the mapping, got %d", v)
+	}
+
+	as.RemoveMapping(id)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected reading a removed mapping to panic")
+			}
+		}()
+		as.Peek(0x6010)
+	}()
+
+	as.AddMapping(0x6000, 0x80, memory.MMAP_MODE_READ, low, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x6000
+	})
+	if v := as.Peek(0x6010); v != 1 {
+		t.Fatalf("expected 1 after adding a mapping at runtime, got %d", v)
+	}
+}
+
+func TestOverlappingMappings(t *testing.T) {
+	as := &memory.AddressSpaceImpl{}
+	low := ram.NewRAM(0x1000)
+	high := ram.NewRAM(0x10)
+	low.Poke(0x120, 1)
+	low.Poke(0x110, 3)
+	high.Poke(0, 2)
+	as.AddMapping(0x6000, 0x1000, memory.MMAP_MODE_READ, low, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x6000
+	})
+	as.AddMapping(0x6110, 0x10, memory.MMAP_MODE_READ, high, func(addr memory.Ptr) memory.Ptr {
+		return addr - 0x6110
+	})
+	as.Map()
+	if v := as.Peek(0x6110); v != 2 {
+		t.Errorf("expected the mapping with the higher offset to win, got %d", v)
+	}
+	if v := as.Peek(0x6120); v != 1 {
+		t.Errorf("expected the lower mapping past the end of the higher one, got %d", v)
+	}
+}
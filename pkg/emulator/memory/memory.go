@@ -8,3 +8,8 @@ type Memory interface {
 	Peek(addr Ptr) byte
 	Poke(addr Ptr, val byte)
 }
+
+// OpcodeFetcher is implemented by memories that distinguish opcode fetches from data reads.
+type OpcodeFetcher interface {
+	Fetch(addr Ptr) byte
+}
@@ -0,0 +1,99 @@
+package memory
+
+import "fmt"
+
+// Watchpoints observe accesses to ranges of an address space, for debuggers and scripts.
+// Only pages containing a watched range pay for the check,
+// so an address space without watchpoints runs at full speed.
+
+type AccessKind uint
+
+const (
+	ACCESS_READ AccessKind = 1 << iota
+	ACCESS_WRITE
+	ACCESS_EXEC // opcode fetch
+)
+
+type Access struct {
+	Kind  AccessKind
+	Addr  Ptr
+	Value byte
+}
+
+type WatchpointHandler func(access Access)
+
+type Watchpoint struct {
+	// inclusive address range
+	Start, End Ptr
+	// kinds of accesses to watch
+	Kind AccessKind
+	// only trigger when the accessed value equals Value
+	MatchValue bool
+	Value      byte
+	Handler    WatchpointHandler
+}
+
+type WatchpointID int
+
+// Watchable is implemented by address spaces supporting watchpoints.
+type Watchable interface {
+	AddWatchpoint(wp Watchpoint) WatchpointID
+	RemoveWatchpoint(id WatchpointID)
+}
+
+type watchpointEntry struct {
+	id WatchpointID
+	Watchpoint
+}
+
+type watchpoints struct {
+	entries []watchpointEntry
+	nextID  WatchpointID
+}
+
+func (p *watchpoints) notify(access Access) {
+	for i := range p.entries {
+		wp := &p.entries[i]
+		if wp.Kind&access.Kind == 0 || access.Addr < wp.Start || access.Addr > wp.End ||
+			wp.MatchValue && wp.Value != access.Value {
+			continue
+		}
+		wp.Handler(access)
+	}
+}
+
+func (as *AddressSpaceImpl) AddWatchpoint(wp Watchpoint) WatchpointID {
+	if wp.End < wp.Start {
+		panic(fmt.Errorf("invalid watchpoint range 0x%x-0x%x", wp.Start, wp.End))
+	}
+	if wp.Handler == nil {
+		panic(fmt.Errorf("watchpoint 0x%x-0x%x has no handler", wp.Start, wp.End))
+	}
+	as.watchpoints.nextID++
+	id := as.watchpoints.nextID
+	as.watchpoints.entries = append(as.watchpoints.entries, watchpointEntry{id: id, Watchpoint: wp})
+	as.updateWatchedPages()
+	return id
+}
+
+func (as *AddressSpaceImpl) RemoveWatchpoint(id WatchpointID) {
+	entries := as.watchpoints.entries
+	for i := range entries {
+		if entries[i].id == id {
+			as.watchpoints.entries = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	as.updateWatchedPages()
+}
+
+func (as *AddressSpaceImpl) updateWatchedPages() {
+	for page := range as.pageTable {
+		as.pageTable[page].watched = 0
+	}
+	for _, wp := range as.watchpoints.entries {
+		for page := int(wp.Start) >> pageShift; page <= int(wp.End)>>pageShift; page++ {
+			as.pageTable[page].watched |= wp.Kind
+		}
+	}
+}
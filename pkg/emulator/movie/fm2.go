@@ -0,0 +1,232 @@
+/*
+FM2 is the text movie format of FCEUX, http://fceux.com/web/FM2.html
+
+The header is made of "key value" lines, followed by one line per frame:
+
+	|commands|port0|port1|port2|
+
+where the commands are a bitset (1 soft reset, 2 hard reset, ...) and a gamepad port is 8 characters
+for the buttons "RLDUTSBA" (Right, Left, Down, Up, sTart, Select, B, A), '.' or ' ' when released.
+
+GoNES specific data is stored in extra "gones..." header keys, which FCEUX ignores.
+*/
+
+package movie
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FM2_VERSION    = 3
+	fm2Buttons     = "RLDUTSBA"
+	base64Prefix   = "base64:"
+	fm2EmuVersion  = 20000
+	fm2PortGamepad = 1
+)
+
+func encodeBase64(data []byte) string {
+	return base64Prefix + base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeBinary(value string) ([]byte, error) {
+	if strings.HasPrefix(value, base64Prefix) {
+		return base64.StdEncoding.DecodeString(value[len(base64Prefix):])
+	}
+	// otherwise a hex string, optionally prefixed with 0x
+	value = strings.TrimPrefix(value, "0x")
+	data := make([]byte, len(value)/2)
+	for i := range data {
+		b, err := strconv.ParseUint(value[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = byte(b)
+	}
+	return data, nil
+}
+
+func formatButtons(buttons byte) string {
+	s := []byte(fm2Buttons)
+	for i := range s {
+		if buttons&(0x80>>uint(i)) == 0 {
+			s[i] = '.'
+		}
+	}
+	return string(s)
+}
+
+func parseButtons(s string) (byte, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if len(s) != len(fm2Buttons) {
+		return 0, fmt.Errorf("gamepad input %q should have %d buttons", s, len(fm2Buttons))
+	}
+	var buttons byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '.' && s[i] != ' ' {
+			buttons |= 0x80 >> uint(i)
+		}
+	}
+	return buttons, nil
+}
+
+// ReadFM2 parses a movie in the FM2 format.
+func ReadFM2(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if line[0] == '|' {
+			frame, err := parseFrame(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			m.Frames = append(m.Frames, frame)
+			continue
+		}
+		var key, value string
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			key, value = line[:i], line[i+1:]
+		} else {
+			key = line
+		}
+		if err := m.setHeader(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.Version == 0 {
+		return nil, fmt.Errorf("not a FM2 movie: no version")
+	}
+	return m, nil
+}
+
+func parseFrame(line string) (Frame, error) {
+	var frame Frame
+	fields := strings.Split(line, "|")
+	// a leading and a trailing empty field around commands and 3 ports
+	if len(fields) < 4 {
+		return frame, fmt.Errorf("malformed input line %q", line)
+	}
+	commands, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return frame, fmt.Errorf("malformed commands in input line %q", line)
+	}
+	frame.Commands = Command(commands)
+	for port := 0; port < len(frame.Input); port++ {
+		if frame.Input[port], err = parseButtons(fields[2+port]); err != nil {
+			return frame, err
+		}
+	}
+	return frame, nil
+}
+
+func parseBool(value string) bool {
+	return value == "1" || value == "true"
+}
+
+func (m *Movie) setHeader(key, value string) error {
+	var err error
+	switch key {
+	case "version":
+		m.Version, err = strconv.Atoi(value)
+	case "emuVersion":
+		m.EmuVersion, err = strconv.Atoi(value)
+	case "rerecordCount":
+		m.RerecordCount, err = strconv.Atoi(value)
+	case "palFlag":
+		m.PAL = parseBool(value)
+	case "romFilename":
+		m.RomFilename = value
+	case "romChecksum":
+		m.RomChecksum, err = decodeBinary(value)
+	case "guid":
+		m.GUID = value
+	case "fourscore":
+		if parseBool(value) {
+			err = fmt.Errorf("four score movies are not supported")
+		}
+	case "port0", "port1":
+		if value != "0" && value != strconv.Itoa(fm2PortGamepad) {
+			err = fmt.Errorf("%s: only gamepads are supported", key)
+		}
+	case "comment":
+		m.Comments = append(m.Comments, value)
+	case "savestate":
+		err = fmt.Errorf("movies starting from a FCEUX save state are not supported")
+	case "binary":
+		if parseBool(value) {
+			err = fmt.Errorf("binary FM2 movies are not supported")
+		}
+	case "gonesSavestate":
+		m.Savestate, err = decodeBinary(value)
+	case "gonesRamInit":
+		m.RAMInit = value
+	case "gonesRamSeed":
+		m.RAMSeed, err = strconv.ParseInt(value, 10, 64)
+	case "gonesFinalFrame":
+		m.FinalFrame, err = strconv.Atoi(value)
+	case "gonesFinalHash":
+		m.FinalHash, err = decodeBinary(value)
+	default:
+		// other keys like port2, NewPPU or subtitle don't affect playback
+	}
+	if err != nil {
+		return fmt.Errorf("invalid header %s: %v", key, err)
+	}
+	return nil
+}
+
+// WriteFM2 writes the movie in the FM2 format.
+func (m *Movie) WriteFM2(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "version %d\n", FM2_VERSION)
+	fmt.Fprintf(bw, "emuVersion %d\n", fm2EmuVersion)
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.RerecordCount)
+	if m.PAL {
+		fmt.Fprintf(bw, "palFlag 1\n")
+	} else {
+		fmt.Fprintf(bw, "palFlag 0\n")
+	}
+	fmt.Fprintf(bw, "romFilename %s\n", m.RomFilename)
+	fmt.Fprintf(bw, "romChecksum %s\n", encodeBase64(m.RomChecksum))
+	fmt.Fprintf(bw, "guid %s\n", m.GUID)
+	fmt.Fprintf(bw, "fourscore 0\n")
+	fmt.Fprintf(bw, "port0 %d\n", fm2PortGamepad)
+	fmt.Fprintf(bw, "port1 %d\n", fm2PortGamepad)
+	fmt.Fprintf(bw, "port2 0\n")
+	for _, comment := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", comment)
+	}
+	if m.Savestate != nil {
+		fmt.Fprintf(bw, "gonesSavestate %s\n", encodeBase64(m.Savestate))
+	}
+	if m.RAMInit != "" {
+		fmt.Fprintf(bw, "gonesRamInit %s\n", m.RAMInit)
+		fmt.Fprintf(bw, "gonesRamSeed %d\n", m.RAMSeed)
+	}
+	if m.FinalHash != nil {
+		fmt.Fprintf(bw, "gonesFinalFrame %d\n", m.FinalFrame)
+		fmt.Fprintf(bw, "gonesFinalHash %s\n", encodeBase64(m.FinalHash))
+	}
+	for _, frame := range m.Frames {
+		fmt.Fprintf(bw, "|%d|%s|%s||\n", frame.Commands,
+			formatButtons(frame.Input[0]), formatButtons(frame.Input[1]))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,80 @@
+package movie
+
+import (
+	"bytes"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFM2RoundTrip(t *testing.T) {
+	m := NewMovie("game.nes", []byte{0xde, 0xad, 0xbe, 0xef})
+	m.RAMInit = "random"
+	m.RAMSeed = 42
+	m.Comments = []string{"author tester"}
+	recorder := NewRecorder(m)
+	recorder.Record(0, joypad.Input{})
+	recorder.Record(COMMAND_SOFT_RESET, joypad.Input{joypad.Button_A | joypad.Button_Right, joypad.Button_Start})
+	recorder.Record(0, joypad.Input{joypad.Button_Up | joypad.Button_Select, 0})
+	recorder.Finish([]byte{1, 2, 3})
+
+	var buf bytes.Buffer
+	if err := m.WriteFM2(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "|1|R......A|....T...||\n") {
+		t.Errorf("unexpected input log:\n%s", buf.String())
+	}
+	read, err := ReadFM2(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.EmuVersion = m.EmuVersion
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("movie changed after a round trip:\n%+v\n%+v", read, m)
+	}
+}
+
+func TestReadFM2(t *testing.T) {
+	fm2 := "version 3\nemuVersion 22020\nromFilename smb\nromChecksum base64:AAECAwQFBgcICQoLDA0ODw==\n" +
+		"guid 452DE2C3-EF43-2FA9-77AC-0677FC51543B\nport0 1\nport1 0\nport2 0\nNewPPU 0\n" +
+		"|0|........|||\n|2|...U..B.|||\n"
+	m, err := ReadFM2(strings.NewReader(fm2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.RomChecksum) != 16 || m.RomChecksum[15] != 15 {
+		t.Errorf("unexpected ROM checksum %x", m.RomChecksum)
+	}
+	expected := []Frame{{}, {COMMAND_HARD_RESET, joypad.Input{joypad.Button_Up | joypad.Button_B, 0}}}
+	if !reflect.DeepEqual(m.Frames, expected) {
+		t.Errorf("expected frames %v, got %v", expected, m.Frames)
+	}
+
+	player := NewPlayer(m)
+	for i := range expected {
+		if frame, ok := player.Next(); !ok || frame != expected[i] {
+			t.Errorf("frame %d: expected %v, got %v", i, expected[i], frame)
+		}
+	}
+	if _, ok := player.Next(); ok {
+		t.Errorf("movie should be finished")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := NewMovie("game.nes", nil)
+	m.Frames = make([]Frame, 2)
+	m.FinalFrame = 2
+	m.FinalHash = []byte{1}
+	player := NewPlayer(m)
+	player.Next()
+	player.Next()
+	if err := player.Verify([]byte{2}); err == nil {
+		t.Errorf("desync not detected")
+	}
+	if err := player.Verify([]byte{1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
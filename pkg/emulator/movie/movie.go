@@ -0,0 +1,153 @@
+// Package movie records and plays back the controller input of every frame,
+// so that a run of a game can be reproduced exactly.
+package movie
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+)
+
+// Command is a bitset of events happening at the start of a frame.
+type Command byte
+
+const (
+	COMMAND_SOFT_RESET Command = 1 << iota
+	COMMAND_HARD_RESET
+	// eject or insert the disk of the Famicom Disk System
+	COMMAND_FDS_INSERT
+	// select the next disk side
+	COMMAND_FDS_SELECT
+)
+
+type Frame struct {
+	Commands Command
+	Input    joypad.Input
+}
+
+type Movie struct {
+	Version       int
+	EmuVersion    int
+	RerecordCount int
+	PAL           bool
+	RomFilename   string
+	// MD5 of the PRG and CHR ROM, as computed by FCEUX
+	RomChecksum []byte
+	GUID        string
+	Comments    []string
+	// save state the movie starts from, or nil to start from power-on
+	Savestate []byte
+	// power-on RAM contents, see ram.ParseInitPattern
+	RAMInit string
+	RAMSeed int64
+	// hash of the machine after the last frame, used to detect desyncs on playback
+	FinalFrame int
+	FinalHash  []byte
+	Frames     []Frame
+}
+
+// NewMovie creates an empty movie for the given ROM.
+func NewMovie(romFilename string, romChecksum []byte) *Movie {
+	return &Movie{
+		Version:     FM2_VERSION,
+		RomFilename: romFilename,
+		RomChecksum: romChecksum,
+		GUID:        newGUID(),
+	}
+}
+
+func newGUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Recorder appends the input of every emulated frame to a movie.
+type Recorder struct {
+	movie *Movie
+}
+
+func NewRecorder(movie *Movie) *Recorder {
+	return &Recorder{movie: movie}
+}
+
+func (p *Recorder) Movie() *Movie {
+	return p.movie
+}
+
+// Record is called at the start of every frame with the input of this frame.
+func (p *Recorder) Record(commands Command, input joypad.Input) {
+	p.movie.Frames = append(p.movie.Frames, Frame{Commands: commands, Input: input})
+}
+
+// Finish stores the hash of the machine after the last recorded frame.
+func (p *Recorder) Finish(hash []byte) {
+	p.movie.FinalFrame = len(p.movie.Frames)
+	p.movie.FinalHash = hash
+}
+
+// Player feeds the input of a movie to the emulated frames.
+type Player struct {
+	movie *Movie
+	frame int
+}
+
+func NewPlayer(movie *Movie) *Player {
+	return &Player{movie: movie}
+}
+
+func (p *Player) Movie() *Movie {
+	return p.movie
+}
+
+// Frame returns the number of frames played so far.
+func (p *Player) Frame() int {
+	return p.frame
+}
+
+func (p *Player) Finished() bool {
+	return p.frame >= len(p.movie.Frames)
+}
+
+// Next returns the input of the next frame, or false once the movie is over.
+func (p *Player) Next() (Frame, bool) {
+	if p.Finished() {
+		return Frame{}, false
+	}
+	frame := p.movie.Frames[p.frame]
+	p.frame++
+	return frame, true
+}
+
+// Verify checks the hash of the machine against the one recorded at the same frame.
+// Movies without a final hash, or hashes taken at other frames, are not checked.
+func (p *Player) Verify(hash []byte) error {
+	if p.movie.FinalHash == nil || p.frame != p.movie.FinalFrame {
+		return nil
+	}
+	if !bytes.Equal(hash, p.movie.FinalHash) {
+		return fmt.Errorf("movie desynchronized: machine hash at frame %d is %x, but %x was recorded",
+			p.frame, hash, p.movie.FinalHash)
+	}
+	return nil
+}
+
+// Truncate drops the frames recorded after the given frame, when recording restarts from an earlier point.
+func (p *Recorder) Truncate(frames int) {
+	if frames < len(p.movie.Frames) {
+		p.movie.Frames = p.movie.Frames[:frames]
+		p.movie.RerecordCount++
+	}
+}
+
+// RomChecksum computes the ROM checksum stored in movies, the MD5 of PRG and CHR ROM.
+func RomChecksum(prg, chr []byte) []byte {
+	h := md5.New()
+	h.Write(prg)
+	h.Write(chr)
+	return h.Sum(nil)
+}
@@ -0,0 +1,76 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// batteryRam returns the battery-backed RAM of the loaded cartridge, nil if it has none.
+func (nes *NESImpl) batteryRam() []byte {
+	if battery, ok := nes.mapper.(mappers.BatteryBacked); ok {
+		return battery.BatteryRam()
+	}
+	return nil
+}
+
+// batteryPath returns the .sav file keeping the battery-backed RAM of the loaded cartridge.
+func (nes *NESImpl) batteryPath() (string, error) {
+	dir := nes.config.SaveDir
+	if dir == "" {
+		dataDir, err := nes.dataDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(dataDir, "saves")
+	}
+	return filepath.Join(dir, hex.EncodeToString(nes.romHash[:])+".sav"), nil
+}
+
+// loadBattery fills the battery-backed RAM of the loaded cartridge from its .sav file, if any.
+func (nes *NESImpl) loadBattery() error {
+	nes.savedBattery = nil
+	ram := nes.batteryRam()
+	if ram == nil {
+		return nil
+	}
+	nes.savedBattery = append([]byte{}, ram...)
+	path, err := nes.batteryPath()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(data) != len(ram) {
+		return fmt.Errorf("%v has %d bytes, %d expected", path, len(data), len(ram))
+	}
+	copy(ram, data)
+	copy(nes.savedBattery, data)
+	logger.Infof("battery-backed RAM loaded from %v", path)
+	return nil
+}
+
+// flushBattery writes the battery-backed RAM if it changed since loaded or written.
+func (nes *NESImpl) flushBattery() error {
+	ram := nes.batteryRam()
+	if ram == nil || bytes.Equal(ram, nes.savedBattery) {
+		return nil
+	}
+	path, err := nes.batteryPath()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(path, ram); err != nil {
+		return err
+	}
+	nes.savedBattery = append(nes.savedBattery[:0], ram...)
+	return nil
+}
@@ -16,3 +16,9 @@ const (
 	CpuClockRate    = MasterClockRate / 12
 	PpuClockRate    = MasterClockRate / 4
 )
+
+// resolution 256x240
+const (
+	SCREEN_WIDTH  = 256
+	SCREEN_HEIGHT = 240
+)
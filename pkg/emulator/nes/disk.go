@@ -0,0 +1,60 @@
+package nes
+
+import (
+	"bytes"
+	"github.com/vfreex/gones/pkg/emulator/common/datadir"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"os"
+	"path/filepath"
+)
+
+// diskPath returns the file keeping the disk of the loaded cartridge as modified by the games,
+// which leave the original disk image untouched.
+func (nes *NESImpl) diskPath() (string, error) {
+	dataDir, err := nes.dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(datadir.RomDir(dataDir, "disks", nes.romHash[:]), "disk.fds"), nil
+}
+
+// loadDisk replaces the disk of the loaded cartridge with the modified disk, if any.
+func (nes *NESImpl) loadDisk() error {
+	drive, ok := nes.mapper.(mappers.DiskDrive)
+	if !ok {
+		return nil
+	}
+	path, err := nes.diskPath()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := drive.LoadDisk(f); err != nil {
+		return err
+	}
+	logger.Infof("modified disk loaded from %v", path)
+	return nil
+}
+
+// flushDisk writes the disk if it was modified since loaded or written.
+func (nes *NESImpl) flushDisk() error {
+	drive, ok := nes.mapper.(mappers.DiskDrive)
+	if !ok || !drive.DiskModified() {
+		return nil
+	}
+	path, err := nes.diskPath()
+	if err != nil {
+		return err
+	}
+	disk := &bytes.Buffer{}
+	if err := drive.SaveDisk(disk); err != nil {
+		return err
+	}
+	return writeFile(path, disk.Bytes())
+}
@@ -0,0 +1,44 @@
+package nes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// frames between writes of modified disks and battery-backed RAM, so a crash loses little
+const FLUSH_INTERVAL = 600
+
+func (nes *NESImpl) Flush() error {
+	if nes.mapper == nil {
+		return nil
+	}
+	diskErr := nes.flushDisk()
+	if err := nes.flushBattery(); err != nil {
+		return err
+	}
+	return diskErr
+}
+
+func (nes *NESImpl) flushPeriodically() {
+	nes.framesSinceFlush++
+	if nes.framesSinceFlush < FLUSH_INTERVAL {
+		return
+	}
+	nes.framesSinceFlush = 0
+	if err := nes.Flush(); err != nil {
+		logger.Warnf("error writing saved data: %v", err)
+	}
+}
+
+// writeFile writes the file aside first and renames it, so a crash can't leave a partial file.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,36 @@
+package nes
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/ppu"
+	"sync"
+)
+
+// FrameBuffer hands the frames rendered on the emulation goroutine over to a frontend.
+// A complete frame is copied into the back buffer, which is then swapped with the front buffer under a lock,
+// so the frontend never sees a frame while it is being rendered.
+type FrameBuffer struct {
+	lock   sync.Mutex
+	frames [2][SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor
+	// only changed by Push, on the emulation goroutine
+	front int
+}
+
+func NewFrameBuffer() *FrameBuffer {
+	return &FrameBuffer{}
+}
+
+// Push copies a complete frame into the back buffer and makes it the front buffer.
+func (p *FrameBuffer) Push(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor) {
+	back := 1 - p.front
+	p.frames[back] = *frame
+	p.lock.Lock()
+	p.front = back
+	p.lock.Unlock()
+}
+
+// Read calls f with the front buffer, which doesn't change until f returns.
+func (p *FrameBuffer) Read(f func(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	f(&p.frames[p.front])
+}
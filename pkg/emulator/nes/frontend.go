@@ -0,0 +1,61 @@
+package nes
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+)
+
+type CommandKind int
+
+const (
+	// stop emulating at the end of the current frame
+	COMMAND_PAUSE CommandKind = iota
+	COMMAND_RESUME
+	// while paused, execute a single CPU instruction or a single frame
+	COMMAND_STEP_INSTRUCTION
+	COMMAND_STEP_FRAME
+	COMMAND_RESET
+	COMMAND_POWER_CYCLE
+	// save into or load from Command.Slot
+	COMMAND_SAVE_SLOT
+	COMMAND_LOAD_SLOT
+	// eject the disk of the Famicom Disk System, or insert it,
+	// and select the side to insert while it is ejected
+	COMMAND_INSERT_EJECT_DISK
+	COMMAND_SELECT_DISK_SIDE
+	// stop the emulation and close the frontend
+	COMMAND_QUIT
+)
+
+// Command controls the emulation from a frontend.
+type Command struct {
+	Kind CommandKind
+	// quick-save slot of COMMAND_SAVE_SLOT and COMMAND_LOAD_SLOT
+	Slot int
+}
+
+// Input is the state of the controls held by the user.
+type Input struct {
+	Joypads joypad.Input
+	// play backwards while set
+	Rewind bool
+}
+
+// Frontend presents the emulated machine to the user and takes their input.
+// Except Run, its methods are called from the emulation goroutine.
+type Frontend interface {
+	// Run shows the frontend and blocks until the user quits or Quit is called
+	Run() error
+	Quit()
+	// PresentFrame is called once a new frame is in the front buffer of frames
+	PresentFrame(frames *FrameBuffer)
+	// PollInput returns the controls held by the user, latched once at the start of every frame
+	PollInput() Input
+	// Commands delivers the control commands of the user
+	Commands() <-chan Command
+	// OutputAudio plays mono samples in [-1, 1], produced by the APU once there is one
+	OutputAudio(samples []float32)
+	// SetSaveSlots tells where the quick-save slots of the loaded ROM are stored
+	SetSaveSlots(slots *SaveSlots)
+	// SlotSaved is called once a state is saved into a quick-save slot
+	SlotSaved(slot int)
+}
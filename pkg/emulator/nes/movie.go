@@ -0,0 +1,161 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"github.com/vfreex/gones/pkg/emulator/movie"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+)
+
+// RecordMovie records the input of the following frames into m.
+// Recording starts from power-on when called before PowerOn or Start,
+// otherwise the current state is embedded in the movie.
+func (nes *NESImpl) RecordMovie(m *movie.Movie) error {
+	if nes.mapper == nil {
+		return fmt.Errorf("no cartridge is loaded")
+	}
+	if nes.powered {
+		var state bytes.Buffer
+		if err := nes.SaveState(&state); err != nil {
+			return err
+		}
+		m.Savestate = state.Bytes()
+	} else {
+		m.Savestate = nil
+		m.RAMInit = nes.config.RAMInit.String()
+		m.RAMSeed = nes.config.RAMSeed
+	}
+	m.PAL = nes.timing.Region == region.REGION_PAL
+	nes.player = nil
+	nes.recorder = movie.NewRecorder(m)
+	nes.movieStartFrame = nes.rewind.Frame()
+	return nil
+}
+
+// PlayMovie replaces the input of the following frames with the input of m.
+// It must be called before PowerOn or Start for movies starting from power-on.
+func (nes *NESImpl) PlayMovie(m *movie.Movie) error {
+	if nes.mapper == nil {
+		return fmt.Errorf("no cartridge is loaded")
+	}
+	if m.Savestate != nil {
+		if nes.powered {
+			if err := nes.LoadState(bytes.NewReader(m.Savestate)); err != nil {
+				return fmt.Errorf("error loading movie save state: %v", err)
+			}
+		}
+	} else {
+		if nes.powered {
+			return fmt.Errorf("movie starts from power-on and must be played before starting the emulation")
+		}
+		if m.RAMInit != "" {
+			init, err := ram.ParseInitPattern(m.RAMInit)
+			if err != nil {
+				return err
+			}
+			nes.config.RAMInit = init
+			nes.config.RAMSeed = m.RAMSeed
+		}
+	}
+	if m.PAL && nes.config.Region == region.REGION_AUTO {
+		nes.setRegion(region.REGION_PAL)
+	}
+	nes.recorder = nil
+	nes.player = movie.NewPlayer(m)
+	nes.movieErr = nil
+	return nil
+}
+
+// StopMovie stops recording or playing a movie.
+// A recorded movie gets the hash of the final state, so that desyncs are detected on playback.
+func (nes *NESImpl) StopMovie() error {
+	if nes.recorder != nil {
+		nes.recorder.Finish(nes.machineHash())
+	}
+	err := nes.movieErr
+	nes.recorder = nil
+	nes.player = nil
+	nes.movieErr = nil
+	return err
+}
+
+// startMovie finishes setting up a movie set before PowerOn, once the machine is powered up.
+func (nes *NESImpl) startMovie() error {
+	if nes.player != nil && nes.player.Movie().Savestate != nil {
+		if err := nes.LoadState(bytes.NewReader(nes.player.Movie().Savestate)); err != nil {
+			return fmt.Errorf("error loading movie save state: %v", err)
+		}
+	}
+	return nil
+}
+
+// movieFrame returns the commands and input of the next frame,
+// taken from the movie being played or recorded into the movie being recorded.
+func (nes *NESImpl) movieFrame(commands movie.Command, input joypad.Input) (movie.Command, joypad.Input) {
+	if nes.player != nil {
+		frame, ok := nes.player.Next()
+		if !ok {
+			logger.Infof("movie finished after %d frames", nes.player.Frame())
+			nes.player = nil
+			return commands, input
+		}
+		return frame.Commands, frame.Input
+	}
+	if nes.recorder != nil {
+		nes.recorder.Record(commands, input)
+	}
+	return commands, input
+}
+
+// verifyMovie compares the machine with the final hash of the movie being played.
+func (nes *NESImpl) verifyMovie() {
+	if nes.player == nil {
+		return
+	}
+	m := nes.player.Movie()
+	if m.FinalHash == nil || nes.player.Frame() != m.FinalFrame {
+		return
+	}
+	if err := nes.player.Verify(nes.machineHash()); err != nil {
+		logger.Warnf("%v", err)
+		nes.movieErr = err
+	} else {
+		logger.Infof("movie verified at frame %d", nes.player.Frame())
+	}
+}
+
+// truncateMovie drops the recorded frames undone by rewinding.
+func (nes *NESImpl) truncateMovie() {
+	if nes.recorder != nil {
+		nes.recorder.Truncate(nes.rewind.Frame() - nes.movieStartFrame)
+	}
+}
+
+func (nes *NESImpl) applyCommands(commands movie.Command) {
+	if commands&movie.COMMAND_HARD_RESET != 0 {
+		nes.powerUp()
+	} else if commands&movie.COMMAND_SOFT_RESET != 0 {
+		nes.reset()
+	}
+	if drive, ok := nes.mapper.(mappers.DiskDrive); ok {
+		if commands&movie.COMMAND_FDS_SELECT != 0 {
+			drive.SelectNextSide()
+		}
+		if commands&movie.COMMAND_FDS_INSERT != 0 {
+			drive.InsertOrEject()
+		}
+	}
+}
+
+// machineHash identifies the state of the machine through its RAM and the last rendered frame.
+func (nes *NESImpl) machineHash() []byte {
+	h := sha1.New()
+	nes.ram.SaveState(h)
+	binary.Write(h, binary.LittleEndian, &nes.ppu.RenderedBuffer)
+	return h.Sum(nil)
+}
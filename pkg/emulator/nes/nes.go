@@ -2,55 +2,155 @@ package nes
 
 import (
 	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/datadir"
 	pkgLogger "github.com/vfreex/gones/pkg/emulator/common/logger"
 	"github.com/vfreex/gones/pkg/emulator/cpu"
 	"github.com/vfreex/gones/pkg/emulator/joypad"
 	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/movie"
 	"github.com/vfreex/gones/pkg/emulator/ppu"
 	"github.com/vfreex/gones/pkg/emulator/ram"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rewind"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
 	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"io"
+	"sync"
 	"time"
 )
 
-const (
-	FPS = 60
-)
-
 var logger = pkgLogger.GetLogger()
 
 type NES interface {
-	LoadCartridge(cartridge *ines.INesRom) error
-	Start() error
+	LoadCartridge(cartridge *cartridge.Cartridge) error
+	// Start emulates in real time, presenting the machine through a frontend until it quits
+	Start(frontend Frontend) error
+	// SaveState writes a snapshot of the whole machine
+	SaveState(w io.Writer) error
+	// LoadState restores a snapshot taken from the same cartridge
+	LoadState(r io.Reader) error
+	// RecordMovie records the input of every frame into a movie
+	RecordMovie(m *movie.Movie) error
+	// PlayMovie takes the input of every frame from a movie
+	PlayMovie(m *movie.Movie) error
+	// StopMovie stops the movie, returning an error if playback desynchronized
+	StopMovie() error
+
+	// PowerOn powers the machine up without a display, to be driven by RunFrame and StepInstruction.
+	// Start does it by itself.
+	PowerOn() error
+	// RunFrame emulates a frame with the input set by SetInput
+	RunFrame()
+	// StepInstruction executes a CPU instruction and returns the CPU cycles it took
+	StepInstruction() int
+	SetInput(input joypad.Input)
+	// Frame returns the picture rendered by the PPU
+	Frame() *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor
+
+	// The following methods are safe to call from any goroutine and take effect at the start of the next frame.
+	// Pause and Resume only affect emulation in real time by Start.
+	Pause()
+	Resume()
+	// Reset presses the reset button
+	Reset()
+	// PowerCycle turns the machine off and on, reinitializing RAM and mapper state
+	PowerCycle()
+	// Flush writes the battery-backed RAM of the cartridge into its .sav file,
+	// and the changes to the disk of a Famicom Disk System cartridge into the data directory.
+	// Start does it periodically and when it returns; it must not be called while Start runs.
+	Flush() error
+	// Stop makes Start return, once the emulation goroutine has stopped.
+	// It must not be called from the goroutine running the frontend.
+	Stop()
+}
+
+// Config holds the settings of an emulated NES.
+type Config struct {
+	// power-on contents of main RAM, PRG-RAM, CIRAM and OAM
+	RAMInit ram.InitPattern
+	// seed used when RAMInit is ram.INIT_RANDOM
+	RAMSeed int64
+	// directory for save states, disks and other per-user data, datadir.Default() if empty
+	DataDir string
+	// directory for the .sav files of battery-backed RAM, "saves" in DataDir if empty
+	SaveDir string
+	// frames between rewind snapshots and memory used for them, defaults if 0
+	RewindInterval     int
+	RewindMemoryBudget int
+	// console to emulate, from the cartridge header if region.REGION_AUTO
+	Region region.Region
 }
 
 type NESImpl struct {
+	config  Config
 	ticker  *time.Ticker
 	cpu     *cpu.Cpu
 	cpuAS   memory.AddressSpace
-	ram     memory.Memory
+	ram     *ram.MainRAM
 	ppu     *ppu.PPUImpl
 	ppuAS   memory.AddressSpace
 	vram    *ram.CIRam
-	display *NesDiplay
 	joypads *joypad.Joypads
+	mapper  mappers.Mapper
+	// hardware of the mapper clocked by the CPU or raising IRQs, if any
+	mapperClock mappers.CpuClocked
+	mapperIRQ   mappers.IRQSource
+	romHash     RomHash
+	// frames since modified disks and battery-backed RAM were written
+	framesSinceFlush int
+	// battery-backed RAM as last loaded or written, to write it only once changed
+	savedBattery []byte
+	timing       *region.Timing
+	// master clock cycles run by the CPU but not yet by the PPU
+	masterClock int
+	// loaded cartridge, which gives the power-on nametable mirroring
+	cartridge *cartridge.Cartridge
+	rewind    *rewind.Buffer
+	input     joypad.Input
+	powered   bool
+	paused    bool
+	// resets and disk changes to apply at the start of the next frame
+	pendingEvents movie.Command
+	// commands posted from other goroutines, and the channel closed once Start returns
+	lock    sync.Mutex
+	pending []Command
+	running chan struct{}
+	// movie being recorded or played, if any
+	recorder        *movie.Recorder
+	player          *movie.Player
+	movieStartFrame int
+	// desync detected while playing the movie
+	movieErr error
+	// frontend given to Start, nil when headless
+	frontend Frontend
+	frames   *FrameBuffer
+	slots    *SaveSlots
+	// mappings of the loaded cartridge, removed when another cartridge is loaded
+	cartridgeCPUMappings []memory.MappingID
+	cartridgePPUMappings []memory.MappingID
 }
 
-func NewNes() NES {
+func NewNes(config Config) NES {
 	nes := &NESImpl{
+		config:  config,
 		cpuAS:   &memory.AddressSpaceImpl{},
 		ram:     ram.NewMainRAM(),
 		ppuAS:   &memory.AddressSpaceImpl{},
 		vram:    ram.NewCIRam(),
 		joypads: joypad.NewJoypads(),
+		frames:  NewFrameBuffer(),
 	}
+	nes.rewind = rewind.NewBuffer(rewindMachine{nes}, rewind.Config{
+		Interval:     config.RewindInterval,
+		MemoryBudget: config.RewindMemoryBudget,
+	})
 	nes.cpu = cpu.NewCpu(nes.cpuAS)
 	nes.ppu = ppu.NewPPU(nes.ppuAS, nes.cpu)
-	nes.display = NewDisplay(&nes.ppu.RenderedBuffer)
+	nes.setRegion(config.Region)
 
 	// setting up CPU memory map
 	// 0x0000 - ox1fff RAM
-	nes.cpuAS.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
+	nes.cpuAS.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE|memory.MMAP_MODE_EXEC,
 		nes.ram, nil)
 	// fake memory map range
 	nes.cpuAS.AddMapping(0x4000, 0x14, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
@@ -69,115 +169,421 @@ func NewNes() NES {
 
 	// setting up PPU memory map
 	// https://wiki.nesdev.com/w/index.php/PPU_memory_map
+	nes.ppuAS.AddMapping(0x2000, 0x1f00, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
+		nes.vram, nil)
 	nes.ppuAS.AddMapping(0x3F00, 0x100,
 		memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, &nes.ppu.Palette, nil)
 
 	return nes
 }
 
-func (nes *NESImpl) LoadCartridge(cartridge *ines.INesRom) error {
-	if cartridge.Header.Flags6&ines.FLAGS6_FOUR_SCREEN_VRAM_ON != 0 {
-		nes.vram.SetNametableMirroring(0,0)
-		nes.vram.SetNametableMirroring(1,1)
-		nes.vram.SetNametableMirroring(2,2)
-		nes.vram.SetNametableMirroring(3,3)
-	} else if cartridge.Header.Flags6&ines.FLAGS6_VERTICAL_MIRRORING != 0 {
-		nes.vram.SetNametableMirroring(0,0)
-		nes.vram.SetNametableMirroring(1,1)
-		nes.vram.SetNametableMirroring(2,0)
-		nes.vram.SetNametableMirroring(3,1)
-	} else {
-		nes.vram.SetNametableMirroring(0,0)
-		nes.vram.SetNametableMirroring(1,0)
-		nes.vram.SetNametableMirroring(2,1)
-		nes.vram.SetNametableMirroring(3,1)
-	}
+func (nes *NESImpl) LoadCartridge(cartridge *cartridge.Cartridge) error {
 	var mapper mappers.Mapper
-	mapperConstructor := mappers.MapperConstructors[cartridge.Header.GetMapperType()]
+	mapperConstructor := mappers.MapperConstructors[cartridge.Mapper]
 	if mapperConstructor != nil {
 		mapper = mapperConstructor(cartridge)
 	} else {
-		panic(fmt.Errorf("cartridge uses unsupported mapper %v", cartridge.Header.GetMapperType()))
+		panic(fmt.Errorf("cartridge uses unsupported mapper %v", cartridge.Mapper))
 	}
-	mappers.MapAddressSpaces(mapper, nes.cpuAS, nes.ppuAS)
-
-	nes.ppuAS.AddMapping(0x2000, 0x1f00, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
-		nes.vram, nil)
+	// the outgoing cartridge keeps what was saved since the last flush
+	if err := nes.Flush(); err != nil {
+		logger.Warnf("error writing saved data of the unloaded cartridge: %v", err)
+	}
+	nes.unloadCartridge()
+	nes.cartridge = cartridge
+	nes.mapper = mapper
+	nes.mapperClock, _ = mapper.(mappers.CpuClocked)
+	nes.mapperIRQ, _ = mapper.(mappers.IRQSource)
+	nes.setRegion(nes.config.Region)
+	nes.romHash = hashRom(cartridge)
+	nes.cartridgeCPUMappings, nes.cartridgePPUMappings = mappers.MapAddressSpaces(mapper, nes.cpuAS, nes.ppuAS)
+	nes.resetMirroring()
 
 	// mapper may change nametable mirroring at runtime
 	mapper.AddNametableMirroringChangeListener(func(logical, physical int) {
 		nes.vram.SetNametableMirroring(logical, physical)
 	})
 
+	if err := nes.loadDisk(); err != nil {
+		logger.Warnf("error loading the saved disk: %v", err)
+	}
+	if err := nes.loadBattery(); err != nil {
+		logger.Warnf("error loading the battery-backed RAM: %v", err)
+	}
+	nes.rewind.Reset()
 	return nil
 }
 
-func (nes *NESImpl) Start() error {
+// resetMirroring sets the nametable mirroring wired on the cartridge.
+func (nes *NESImpl) resetMirroring() {
+	switch nes.cartridge.Mirroring {
+	case cartridge.MIRRORING_FOUR_SCREEN:
+		nes.vram.SetNametableMirroring(0, 0)
+		nes.vram.SetNametableMirroring(1, 1)
+		nes.vram.SetNametableMirroring(2, 2)
+		nes.vram.SetNametableMirroring(3, 3)
+	case cartridge.MIRRORING_VERTICAL:
+		nes.vram.SetNametableMirroring(0, 0)
+		nes.vram.SetNametableMirroring(1, 1)
+		nes.vram.SetNametableMirroring(2, 0)
+		nes.vram.SetNametableMirroring(3, 1)
+	case cartridge.MIRRORING_SINGLE_SCREEN_A:
+		nes.vram.SetNametableMirroring(0, 0)
+		nes.vram.SetNametableMirroring(1, 0)
+		nes.vram.SetNametableMirroring(2, 0)
+		nes.vram.SetNametableMirroring(3, 0)
+	case cartridge.MIRRORING_SINGLE_SCREEN_B:
+		nes.vram.SetNametableMirroring(0, 1)
+		nes.vram.SetNametableMirroring(1, 1)
+		nes.vram.SetNametableMirroring(2, 1)
+		nes.vram.SetNametableMirroring(3, 1)
+	default:
+		nes.vram.SetNametableMirroring(0, 0)
+		nes.vram.SetNametableMirroring(1, 0)
+		nes.vram.SetNametableMirroring(2, 1)
+		nes.vram.SetNametableMirroring(3, 1)
+	}
+}
+
+// setRegion selects the timing of a region, or the region of the cartridge for region.REGION_AUTO.
+func (nes *NESImpl) setRegion(r region.Region) {
+	if r == region.REGION_AUTO && nes.cartridge != nil {
+		r = nes.cartridge.Region
+	}
+	nes.timing = region.TimingOf(r)
+	nes.ppu.SetTiming(nes.timing)
+	nes.masterClock = 0
+	logger.Infof("emulating a %v console", nes.timing.Region)
+}
+
+func (nes *NESImpl) unloadCartridge() {
+	for _, id := range nes.cartridgeCPUMappings {
+		nes.cpuAS.RemoveMapping(id)
+	}
+	for _, id := range nes.cartridgePPUMappings {
+		nes.ppuAS.RemoveMapping(id)
+	}
+	nes.cartridgeCPUMappings = nil
+	nes.cartridgePPUMappings = nil
+}
+
+func (nes *NESImpl) saveSlot(slot int) {
+	if err := nes.slots.Save(slot, nes, &nes.ppu.RenderedBuffer); err != nil {
+		logger.Warnf("error saving state into slot %d: %v", slot, err)
+		return
+	}
+	logger.Infof("state saved into slot %d", slot)
+	nes.frontend.SlotSaved(slot)
+}
+
+func (nes *NESImpl) loadSlot(slot int) {
+	if err := nes.slots.Load(slot, nes); err != nil {
+		logger.Warnf("error loading state from slot %d: %v", slot, err)
+	} else {
+		logger.Infof("state loaded from slot %d", slot)
+	}
+}
+
+// post queues a command from any goroutine, to be handled at the start of the next frame.
+func (nes *NESImpl) post(command Command) {
+	nes.lock.Lock()
+	nes.pending = append(nes.pending, command)
+	nes.lock.Unlock()
+}
+
+func (nes *NESImpl) Pause() {
+	nes.post(Command{Kind: COMMAND_PAUSE})
+}
+
+func (nes *NESImpl) Resume() {
+	nes.post(Command{Kind: COMMAND_RESUME})
+}
+
+func (nes *NESImpl) Reset() {
+	nes.post(Command{Kind: COMMAND_RESET})
+}
+
+func (nes *NESImpl) PowerCycle() {
+	nes.post(Command{Kind: COMMAND_POWER_CYCLE})
+}
+
+func (nes *NESImpl) Stop() {
+	nes.lock.Lock()
+	running := nes.running
+	nes.lock.Unlock()
+	if running == nil {
+		return
+	}
+	nes.post(Command{Kind: COMMAND_QUIT})
+	<-running
+}
+
+// handleCommands applies the commands posted by other goroutines and queued by the frontend,
+// returning whether a frame should be emulated while paused and whether to quit.
+func (nes *NESImpl) handleCommands() (stepFrame, quit bool) {
+	nes.lock.Lock()
+	pending := nes.pending
+	nes.pending = nil
+	nes.lock.Unlock()
+	for _, command := range pending {
+		nes.handleCommand(command, &stepFrame, &quit)
+	}
+	if nes.frontend == nil {
+		return
+	}
+	for {
+		select {
+		case command := <-nes.frontend.Commands():
+			nes.handleCommand(command, &stepFrame, &quit)
+		default:
+			return
+		}
+	}
+}
+
+func (nes *NESImpl) handleCommand(command Command, stepFrame, quit *bool) {
+	switch command.Kind {
+	case COMMAND_PAUSE:
+		nes.paused = true
+	case COMMAND_RESUME:
+		nes.paused = false
+	case COMMAND_STEP_INSTRUCTION:
+		nes.paused = true
+		nes.StepInstruction()
+	case COMMAND_STEP_FRAME:
+		nes.paused = true
+		*stepFrame = true
+	case COMMAND_RESET:
+		nes.pendingEvents |= movie.COMMAND_SOFT_RESET
+	case COMMAND_POWER_CYCLE:
+		nes.pendingEvents |= movie.COMMAND_HARD_RESET
+	case COMMAND_INSERT_EJECT_DISK:
+		nes.pendingEvents |= movie.COMMAND_FDS_INSERT
+	case COMMAND_SELECT_DISK_SIDE:
+		nes.pendingEvents |= movie.COMMAND_FDS_SELECT
+	case COMMAND_SAVE_SLOT:
+		nes.saveSlot(command.Slot)
+	case COMMAND_LOAD_SLOT:
+		nes.loadSlot(command.Slot)
+	case COMMAND_QUIT:
+		*quit = true
+	}
+}
+
+// runFrame emulates the CPU and PPU for the duration of a frame.
+func (nes *NESImpl) runFrame() (loop int, spentCycles int64) {
+	cyclesPerFrame := int64(nes.timing.CpuCyclesPerFrame())
+	for spentCycles < cyclesPerFrame {
+		spentCycles += int64(nes.StepInstruction())
+		loop++
+		//logger.Debug("")
+	}
+	return
+}
+
+func (nes *NESImpl) StepInstruction() int {
+	cycles := nes.cpu.ExecOneInstruction()
+	//cycles := int64(1)
+	if cycles <= 0 {
+		panic("invalid cycle")
+	}
+	// the PPU runs 3 dots per CPU cycle, or 3.2 on PAL
+	nes.masterClock += cycles * nes.timing.CpuClockDivider
+	for nes.masterClock >= nes.timing.PpuClockDivider {
+		nes.ppu.Step()
+		nes.masterClock -= nes.timing.PpuClockDivider
+	}
+	if nes.mapperClock != nil {
+		nes.mapperClock.ClockCpu(cycles)
+	}
+	if nes.mapperIRQ != nil {
+		nes.cpu.IRQ = nes.mapperIRQ.IRQ()
+	}
+	return cycles
+}
+
+// frame emulates a frame starting with the pending resets, recording or playing back the movie if any.
+func (nes *NESImpl) frame() (loop int, spentCycles int64) {
+	commands, input := nes.movieFrame(nes.pendingEvents, nes.input)
+	nes.pendingEvents = 0
+	if err := nes.rewind.Record(movie.Frame{Commands: commands, Input: input}); err != nil {
+		logger.Warnf("error recording rewind history: %v", err)
+	}
+	nes.applyCommands(commands)
+	nes.joypads.SetInput(input)
+	loop, spentCycles = nes.runFrame()
+	nes.verifyMovie()
+	nes.flushPeriodically()
+	return
+}
+
+func (nes *NESImpl) RunFrame() {
+	nes.handleCommands()
+	nes.frame()
+}
+
+func (nes *NESImpl) SetInput(input joypad.Input) {
+	nes.input = input
+}
+
+func (nes *NESImpl) Frame() *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor {
+	return &nes.ppu.RenderedBuffer
+}
+
+func (nes *NESImpl) powerUp() {
+	init := ram.NewInitializer(nes.config.RAMInit, nes.config.RAMSeed)
+	nes.ram.Fill(init)
+	if nes.mapper != nil {
+		nes.mapper.PowerUp()
+		nes.mapper.FillPrgRam(init)
+		nes.resetMirroring()
+	}
+	nes.vram.Fill(init)
+	nes.ppu.FillOAM(init)
+	if nes.mapper != nil {
+		// last, so the other RAM keeps drawing the same values from the random stream
+		nes.mapper.FillChrRam(init)
+	}
+	nes.ppu.PowerUp()
+	nes.cpu.PowerUp()
+}
+
+// reset is what pressing the reset button does.
+func (nes *NESImpl) reset() {
+	nes.ppu.Reset()
+	nes.cpu.Reset()
+	// TODO: also silence the APU once there is one
+}
+
+func (nes *NESImpl) PowerOn() error {
+	if nes.powered {
+		return nil
+	}
+	if nes.mapper == nil {
+		return fmt.Errorf("no cartridge is loaded")
+	}
 	nes.cpuAS.Map()
 	nes.ppuAS.Map()
+	nes.powerUp()
+	if err := nes.startMovie(); err != nil {
+		return err
+	}
+	nes.powered = true
+	return nil
+}
+
+// dataDir returns the directory for save states and other per-user data.
+func (nes *NESImpl) dataDir() (string, error) {
+	if nes.config.DataDir != "" {
+		return nes.config.DataDir, nil
+	}
+	return datadir.Default()
+}
 
-	const fps = 60
-	interval := 1 * time.Second / fps
-	cpuCyclesPerFrame := 29780
+func (nes *NESImpl) Start(frontend Frontend) error {
+	if err := nes.PowerOn(); err != nil {
+		return err
+	}
+	nes.lock.Lock()
+	if nes.running != nil {
+		nes.lock.Unlock()
+		return fmt.Errorf("emulation is already started")
+	}
+	running := make(chan struct{})
+	nes.running = running
+	nes.dropPendingQuit()
+	nes.lock.Unlock()
+	defer func() {
+		nes.lock.Lock()
+		nes.running = nil
+		nes.lock.Unlock()
+		close(running)
+	}()
+	nes.frontend = frontend
+
+	interval := time.Duration(float64(time.Second) / nes.timing.FrameRate())
 	nes.ticker = time.NewTicker(interval)
 	nes.ppu.NewFrameHandler = func(frame *[240][256]ppu.RBGColor, frameID int) {
-		nes.display.Refresh()
+		nes.frames.Push(frame)
+		frontend.PresentFrame(nes.frames)
 	}
-	cpu := nes.cpu
-	cpu.PowerUp()
+	dataDir, err := nes.dataDir()
+	if err != nil {
+		return err
+	}
+	nes.slots = NewSaveSlots(dataDir, nes.romHash)
+	frontend.SetSaveSlots(nes.slots)
 
-	frames := 0
+	stop := make(chan struct{})
+	done := make(chan struct{})
 	go func() {
-		for tick := range nes.ticker.C {
-			//tick:=time.Now()
-			logger.Infof("At time %v", tick)
-
-			spentCycles := int64(0)
-			loop := 0
-			for spentCycles < int64(cpuCyclesPerFrame) {
-				if nes.display.RequestReset {
-					nes.cpu.Reset()
-					nes.display.RequestReset = false
-				}
-				if nes.display.StepInstruction {
-					<-nes.display.NextCh
-				}
-				cycles := int64(cpu.ExecOneInstruction())
-				//cycles := int64(1)
-				if cycles <= 0 {
-					panic("invalid cycle")
-				}
-				for pp := int64(0); pp < cycles*3; pp++ {
-					nes.ppu.Step()
-				}
-				spentCycles += cycles
-				loop++
-				//logger.Debug("")
-				//logger.Infof("spent %d/%d CPU cycles", spentCycles, cpuCyclesPerFrame)
-			}
-			//nes.display.Refresh()
-			// update joypad
-			nes.joypads.Joypads[0].Buttons = nes.display.Keys
-			//logger.SetOutput(os.Stderr)
-			logger.Info("----------------------------------------------------------")
-			now := time.Now()
-			actualTime := now.Sub(tick)
-			logger.Infof("spent %v/%v to render frame #%d after running %v loops / %v cycles",
-				actualTime, interval, frames, loop, spentCycles)
-			frames++
-			//nes.ticker.Stop()
-			//close(stopCh)
-			if nes.display.StepFrame {
-				ch := <-nes.display.NextCh
-				if ch == 0xff {
-					nes.cpu.Reset()
-					// TODO: also reset PPU?
+		defer close(done)
+		nes.emulate(interval, stop)
+	}()
+	err = frontend.Run()
+	// wait for the emulation goroutine, so the machine can be used again once Start returns
+	close(stop)
+	<-done
+	nes.ticker.Stop()
+	if flushErr := nes.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// emulate runs a frame at every tick until stopped or a COMMAND_QUIT is received.
+func (nes *NESImpl) emulate(interval time.Duration, stop <-chan struct{}) {
+	frames := 0
+	for {
+		var tick time.Time
+		select {
+		case <-stop:
+			return
+		case tick = <-nes.ticker.C:
+		}
+		//tick:=time.Now()
+		logger.Infof("At time %v", tick)
+
+		stepFrame, quit := nes.handleCommands()
+		if quit {
+			nes.frontend.Quit()
+			return
+		}
+		if nes.paused && !stepFrame {
+			continue
+		}
+		input := nes.frontend.PollInput()
+		if input.Rewind && nes.player == nil {
+			// play backwards while the rewind key is held, but not before the movie being recorded
+			if nes.rewind.CanStepBack() && (nes.recorder == nil || nes.rewind.Frame() > nes.movieStartFrame) {
+				if err := nes.rewind.StepBack(); err != nil {
+					logger.Warnf("error rewinding: %v", err)
 				}
+				nes.truncateMovie()
 			}
+			continue
 		}
-	}()
-	nes.display.Show()
-	//<-stopCh
-	nes.ticker.Stop()
-	return nil
+		// update joypad
+		nes.SetInput(input.Joypads)
+		loop, spentCycles := nes.frame()
+		//logger.SetOutput(os.Stderr)
+		logger.Info("----------------------------------------------------------")
+		now := time.Now()
+		actualTime := now.Sub(tick)
+		logger.Infof("spent %v/%v to render frame #%d after running %v loops / %v cycles",
+			actualTime, interval, frames, loop, spentCycles)
+		frames++
+	}
+}
+
+// dropPendingQuit drops a quit command posted by Stop after a previous Start returned.
+// The lock must be held.
+func (nes *NESImpl) dropPendingQuit() {
+	pending := nes.pending[:0]
+	for _, command := range nes.pending {
+		if command.Kind != COMMAND_QUIT {
+			pending = append(pending, command)
+		}
+	}
+	nes.pending = pending
 }
@@ -0,0 +1,559 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"github.com/vfreex/gones/pkg/emulator/movie"
+	"github.com/vfreex/gones/pkg/emulator/ppu"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"github.com/vfreex/gones/pkg/emulator/savestate"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testProgram reads the first joypad and accumulates its buttons at $00, counting loops at $01.
+var testProgram = []byte{
+	0xa9, 0x01, // LDA #$01
+	0x8d, 0x16, 0x40, // STA $4016
+	0xa9, 0x00, // LDA #$00
+	0x8d, 0x16, 0x40, // STA $4016
+	0xad, 0x16, 0x40, // LDA $4016
+	0x18,       // CLC
+	0x65, 0x00, // ADC $00
+	0x85, 0x00, // STA $00
+	0xe6, 0x01, // INC $01
+	0x4c, 0x00, 0x80, // JMP $8000
+}
+
+func newTestRom() *cartridge.Cartridge {
+	prg := make([]byte, ines.PRG_BANK_SIZE)
+	copy(prg, testProgram)
+	// NMI, reset and IRQ vectors
+	copy(prg[0x3ffa:], []byte{0x00, 0x80, 0x00, 0x80, 0x00, 0x80})
+	return &cartridge.Cartridge{
+		Mapper: ines.MAPPER_NORM,
+		PrgBin: prg,
+		ChrBin: make([]byte, ines.CHR_BANK_SIZE),
+		Region: region.REGION_NTSC,
+	}
+}
+
+func newTestNes(t *testing.T) *NESImpl {
+	nes := NewNes(Config{}).(*NESImpl)
+	if err := nes.LoadCartridge(newTestRom()); err != nil {
+		t.Fatal(err)
+	}
+	return nes
+}
+
+func TestMoviePlayback(t *testing.T) {
+	recording := newTestNes(t)
+	m := movie.NewMovie("test.nes", nil)
+	if err := recording.RecordMovie(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := recording.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		recording.SetInput(joypad.Input{byte(i), 0})
+		recording.RunFrame()
+	}
+	if err := recording.StopMovie(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Frames) != 20 || m.FinalHash == nil {
+		t.Fatalf("expected 20 recorded frames and a final hash, got %d frames", len(m.Frames))
+	}
+
+	play := func(m *movie.Movie) error {
+		nes := newTestNes(t)
+		if err := nes.PlayMovie(m); err != nil {
+			t.Fatal(err)
+		}
+		if err := nes.PowerOn(); err != nil {
+			t.Fatal(err)
+		}
+		for range m.Frames {
+			nes.RunFrame()
+		}
+		return nes.StopMovie()
+	}
+	if err := play(m); err != nil {
+		t.Errorf("unexpected desync: %v", err)
+	}
+	m.Frames[10].Input[0] ^= joypad.Button_A
+	if err := play(m); err == nil {
+		t.Errorf("desync not detected after changing the input")
+	}
+}
+
+// testFrontend reads frames like a UI goroutine would, and quits after quitAfter frames if not 0.
+type testFrontend struct {
+	commands  chan Command
+	presented chan *FrameBuffer
+	frames    int
+	quitAfter int
+}
+
+func newTestFrontend(quitAfter int) *testFrontend {
+	return &testFrontend{
+		commands:  make(chan Command, 1),
+		presented: make(chan *FrameBuffer, 1),
+		quitAfter: quitAfter,
+	}
+}
+
+func (p *testFrontend) Run() error {
+	for frames := range p.presented {
+		frames.Read(func(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor) {
+			_ = frame[0][0]
+		})
+		p.frames++
+		if p.frames == 5 {
+			p.commands <- Command{Kind: COMMAND_RESET}
+		}
+		if p.frames == p.quitAfter {
+			p.commands <- Command{Kind: COMMAND_QUIT}
+		}
+	}
+	return nil
+}
+
+func (p *testFrontend) Quit() {
+	close(p.presented)
+}
+
+func (p *testFrontend) PresentFrame(frames *FrameBuffer) {
+	p.presented <- frames
+}
+
+func (p *testFrontend) PollInput() Input {
+	return Input{Joypads: joypad.Input{joypad.Button_Start, 0}}
+}
+
+func (p *testFrontend) Commands() <-chan Command {
+	return p.commands
+}
+
+func (p *testFrontend) OutputAudio(samples []float32) {}
+
+func (p *testFrontend) SetSaveSlots(slots *SaveSlots) {}
+
+func (p *testFrontend) SlotSaved(slot int) {}
+
+func newStartableNes(t *testing.T) (*NESImpl, func()) {
+	dataDir, err := ioutil.TempDir("", "gones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nes := NewNes(Config{DataDir: dataDir}).(*NESImpl)
+	if err := nes.LoadCartridge(newTestRom()); err != nil {
+		t.Fatal(err)
+	}
+	return nes, func() { os.RemoveAll(dataDir) }
+}
+
+func TestStart(t *testing.T) {
+	nes, cleanup := newStartableNes(t)
+	defer cleanup()
+	frontend := newTestFrontend(10)
+	if err := nes.Start(frontend); err != nil {
+		t.Fatal(err)
+	}
+	if frontend.frames < 10 {
+		t.Errorf("expected at least 10 frames, got %d", frontend.frames)
+	}
+	// the machine is usable once Start returns
+	var state bytes.Buffer
+	if err := nes.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	nes, cleanup := newStartableNes(t)
+	defer cleanup()
+	frontend := newTestFrontend(0)
+	go func() {
+		nes.Pause()
+		nes.Reset()
+		nes.PowerCycle()
+		nes.Resume()
+		time.Sleep(100 * time.Millisecond)
+		nes.Stop()
+	}()
+	if err := nes.Start(frontend); err != nil {
+		t.Fatal(err)
+	}
+	// stopping a stopped machine does nothing
+	nes.Stop()
+}
+
+func TestPowerCycle(t *testing.T) {
+	fresh := newTestNes(t)
+	if err := fresh.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	fresh.RunFrame()
+
+	nes := newTestNes(t)
+	if err := nes.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	nes.SetInput(joypad.Input{joypad.Button_A, 0})
+	for i := 0; i < 5; i++ {
+		nes.RunFrame()
+	}
+	nes.SetInput(joypad.Input{})
+	nes.PowerCycle()
+	nes.RunFrame()
+	if !bytes.Equal(nes.machineHash(), fresh.machineHash()) {
+		t.Errorf("machine differs from a freshly powered one after a power cycle")
+	}
+}
+
+func TestRegionTiming(t *testing.T) {
+	for _, r := range []region.Region{region.REGION_NTSC, region.REGION_PAL, region.REGION_DENDY} {
+		nes := NewNes(Config{Region: r}).(*NESImpl)
+		if err := nes.LoadCartridge(newTestRom()); err != nil {
+			t.Fatal(err)
+		}
+		if err := nes.PowerOn(); err != nil {
+			t.Fatal(err)
+		}
+		rendered := 0
+		nes.ppu.NewFrameHandler = func(frame *[240][256]ppu.RBGColor, frameID int) {
+			rendered++
+		}
+		for i := 0; i < 100; i++ {
+			nes.RunFrame()
+		}
+		// the PPU keeps in step with the frames run by the CPU
+		if rendered < 99 || rendered > 101 {
+			t.Errorf("%v: PPU rendered %d frames while the CPU ran 100", r, rendered)
+		}
+	}
+}
+
+func TestBatterySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gones-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rom := newTestRom()
+	rom.Battery, rom.PrgNvramSize = true, 0x2000
+	newNes := func() *NESImpl {
+		nes := NewNes(Config{RAMInit: ram.INIT_ONES, DataDir: dir}).(*NESImpl)
+		if err := nes.LoadCartridge(rom); err != nil {
+			t.Fatal(err)
+		}
+		if err := nes.PowerOn(); err != nil {
+			t.Fatal(err)
+		}
+		return nes
+	}
+
+	nes := newNes()
+	if v := nes.cpuAS.Peek(0x6000); v != 0 {
+		t.Errorf("battery-backed RAM filled with %02x on power-on", v)
+	}
+	if err := nes.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := nes.batteryPath()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unchanged battery-backed RAM written")
+	}
+	nes.cpuAS.Poke(0x6000, 0x42)
+	nes.cpuAS.Poke(0x7fff, 0x24)
+	nes.PowerCycle()
+	nes.RunFrame()
+	if v := nes.cpuAS.Peek(0x6000); v != 0x42 {
+		t.Errorf("battery-backed RAM lost on power cycle, got %02x", v)
+	}
+	if err := nes.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "saves", filepath.Base(path))); err != nil || len(data) != 0x2000 {
+		t.Fatalf("expected a 8 KB .sav file, got %d bytes, %v", len(data), err)
+	}
+
+	nes = newNes()
+	if v0, v1 := nes.cpuAS.Peek(0x6000), nes.cpuAS.Peek(0x7fff); v0 != 0x42 || v1 != 0x24 {
+		t.Errorf("battery-backed RAM not loaded, got %02x %02x", v0, v1)
+	}
+
+	// swapping the cartridge writes its saves
+	nes.cpuAS.Poke(0x6000, 0x43)
+	if err := nes.LoadCartridge(newTestRom()); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || len(data) == 0 || data[0] != 0x43 {
+		t.Errorf("battery-backed RAM not written when unloading the cartridge, %v", err)
+	}
+}
+
+// mmc3Program turns rendering on and asks the MMC3 for an IRQ on every scanline, counting them at $00-$01.
+var mmc3Program = []byte{
+	0xa9, 0x08, // LDA #$08
+	0x8d, 0x00, 0x20, // STA $2000, sprites at $1000
+	0xa9, 0x18, // LDA #$18
+	0x8d, 0x01, 0x20, // STA $2001
+	0xa9, 0x00, // LDA #$00
+	0x8d, 0x00, 0xc0, // STA $C000, IRQ latch
+	0x8d, 0x01, 0xc0, // STA $C001, IRQ reload
+	0x8d, 0x01, 0xe0, // STA $E001, IRQ enable
+	0x58,             // CLI
+	0x4c, 0x16, 0xe0, // JMP $E016
+	// IRQ handler at $E019
+	0x8d, 0x00, 0xe0, // STA $E000, acknowledge
+	0x8d, 0x01, 0xe0, // STA $E001
+	0xe6, 0x00, // INC $00
+	0xd0, 0x02, // BNE $E025
+	0xe6, 0x01, // INC $01
+	0x40, // RTI
+}
+
+func TestMMC3ScanlineIRQ(t *testing.T) {
+	for submapper, expected := range map[int]int{mappers.MMC3_SUBMAPPER_MMC3C: 241, mappers.MMC3_SUBMAPPER_MMC3A: 0} {
+		prg := make([]byte, 2*ines.PRG_BANK_SIZE)
+		copy(prg[0x6000:], mmc3Program)
+		// NMI, reset and IRQ vectors
+		copy(prg[0x7ffa:], []byte{0x25, 0xe0, 0x00, 0xe0, 0x19, 0xe0})
+		nes := NewNes(Config{}).(*NESImpl)
+		if err := nes.LoadCartridge(&cartridge.Cartridge{
+			Mapper:    4,
+			Submapper: submapper,
+			PrgBin:    prg,
+			ChrBin:    make([]byte, ines.CHR_BANK_SIZE),
+			Region:    region.REGION_NTSC,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := nes.PowerOn(); err != nil {
+			t.Fatal(err)
+		}
+		irqs := func() int {
+			return int(nes.cpuAS.Peek(0x00)) | int(nes.cpuAS.Peek(0x01))<<8
+		}
+		for i := 0; i < 3; i++ {
+			nes.RunFrame()
+		}
+		before := irqs()
+		nes.RunFrame()
+		// one rising edge of A12 on each visible scanline and on the pre-render one
+		if n := irqs() - before; n != expected {
+			t.Errorf("submapper %d: %d IRQs in a frame, %d expected", submapper, n, expected)
+		}
+	}
+}
+
+// truncatedState saves a short payload in place of a chunk.
+type truncatedState struct{}
+
+func (truncatedState) SaveState(w io.Writer) error {
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+func (truncatedState) LoadState(r io.Reader) error {
+	return nil
+}
+
+func TestLoadStateRollback(t *testing.T) {
+	nes := newTestNes(t)
+	if err := nes.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	nes.SetInput(joypad.Input{joypad.Button_A, 0})
+	for i := 0; i < 5; i++ {
+		nes.RunFrame()
+	}
+	var previous bytes.Buffer
+	if err := nes.SaveState(&previous); err != nil {
+		t.Fatal(err)
+	}
+	before := nes.machineHash()
+	nes.RunFrame()
+	// states of the same cartridge a frame later, with a broken mapper chunk
+	brokenState := func(component savestate.Stateful, version uint16) *bytes.Buffer {
+		var state bytes.Buffer
+		w, err := savestate.NewWriter(&state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range nes.stateChunks() {
+			if chunk.tag == STATE_CHUNK_MAPPER {
+				chunk.component, chunk.version = component, version
+			}
+			if err := w.WriteChunk(chunk.tag, chunk.version, chunk.component); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &state
+	}
+	states := map[string]*bytes.Buffer{
+		"truncated": brokenState(truncatedState{}, STATE_CHUNK_MAPPER_VERSION),
+		// the layout of PRG-RAM changed after version 1
+		"old": brokenState(nes.mapper, 1),
+	}
+	if err := nes.LoadState(&previous); err != nil {
+		t.Fatal(err)
+	}
+	for name, state := range states {
+		if err := nes.LoadState(state); err == nil {
+			t.Errorf("expected loading a %s mapper chunk to fail", name)
+		}
+		if !bytes.Equal(nes.machineHash(), before) {
+			t.Errorf("machine changed by a state with a %s mapper chunk failing to load", name)
+		}
+	}
+}
+
+func TestSaveSlots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gones-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	nes := newTestNes(t)
+	if err := nes.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	nes.RunFrame()
+
+	slots := NewSaveSlots(dir, nes.romHash)
+	if path := slots.StatePath(3); path != filepath.Join(dir, "states", hex.EncodeToString(nes.romHash[:]), "slot-03.state") {
+		t.Errorf("unexpected state path %s", path)
+	}
+	other := NewSaveSlots(dir, RomHash{1})
+	if filepath.Dir(other.StatePath(1)) == filepath.Dir(slots.StatePath(1)) {
+		t.Errorf("ROMs share the directory of their save slots")
+	}
+	var screen [SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor
+	for y := range screen {
+		for x := range screen[y] {
+			screen[y][x] = ppu.RBGColor(y<<16 | x)
+		}
+	}
+	for _, slot := range []int{0, SAVE_SLOTS + 1} {
+		if err := slots.Save(slot, nes, &screen); err == nil {
+			t.Errorf("saving into slot %d out of range succeeded", slot)
+		}
+	}
+	if slots.HasState(1) {
+		t.Errorf("empty slot has a state")
+	}
+
+	saved := nes.machineHash()
+	if err := slots.Save(1, nes, &screen); err != nil {
+		t.Fatal(err)
+	}
+	if !slots.HasState(1) || other.HasState(1) {
+		t.Errorf("state saved into the wrong slot")
+	}
+	nes.SetInput(joypad.Input{joypad.Button_A, 0})
+	nes.RunFrame()
+	if err := slots.Load(1, nes); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nes.machineHash(), saved) {
+		t.Errorf("machine differs from the one saved in the slot")
+	}
+	if err := other.Load(1, nes); err == nil {
+		t.Errorf("loading an empty slot succeeded")
+	}
+
+	f, err := os.Open(slots.ThumbnailPath(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	thumbnail, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := thumbnail.Bounds().Size(); size.X != THUMBNAIL_WIDTH || size.Y != THUMBNAIL_HEIGHT {
+		t.Fatalf("unexpected thumbnail size %v", size)
+	}
+	// every other pixel of every other line
+	if r, g, b, _ := thumbnail.At(10, 20).RGBA(); r>>8 != 40 || g>>8 != 0 || b>>8 != 20 {
+		t.Errorf("unexpected thumbnail pixel %02x%02x%02x", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestRewindPowerCycle(t *testing.T) {
+	nes := newTestNes(t)
+	if err := nes.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	var hashes [][]byte
+	for i := 0; i < 10; i++ {
+		if i == 6 {
+			nes.PowerCycle()
+		}
+		nes.SetInput(joypad.Input{byte(i), 0})
+		nes.RunFrame()
+		hashes = append(hashes, nes.machineHash())
+	}
+	// back to the start of frame 7, re-emulating the power cycle of frame 6 from the snapshot of frame 4
+	for i := 0; i < 3; i++ {
+		if err := nes.rewind.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(nes.machineHash(), hashes[6]) {
+		t.Errorf("machine differs after rewinding over a power cycle")
+	}
+}
+
+func TestRewindAfterLoadState(t *testing.T) {
+	nes := newTestNes(t)
+	if err := nes.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		nes.RunFrame()
+	}
+	state := &bytes.Buffer{}
+	if err := nes.SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		nes.SetInput(joypad.Input{byte(i), 0})
+		nes.RunFrame()
+	}
+	if err := nes.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+	loaded := nes.machineHash()
+	if nes.rewind.CanStepBack() {
+		t.Errorf("rewind history kept across loading a state")
+	}
+	nes.RunFrame()
+	if err := nes.rewind.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nes.machineHash(), loaded) {
+		t.Errorf("machine differs from the loaded state after rewinding")
+	}
+
+	if err := nes.LoadCartridge(nes.cartridge); err != nil {
+		t.Fatal(err)
+	}
+	if nes.rewind.CanStepBack() {
+		t.Errorf("rewind history kept across swapping the cartridge")
+	}
+}
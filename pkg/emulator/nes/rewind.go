@@ -0,0 +1,25 @@
+package nes
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/movie"
+	"io"
+)
+
+// rewindMachine lets the rewind buffer re-emulate frames with recorded commands and input.
+type rewindMachine struct {
+	nes *NESImpl
+}
+
+func (p rewindMachine) SaveState(w io.Writer) error {
+	return p.nes.SaveState(w)
+}
+
+func (p rewindMachine) LoadState(r io.Reader) error {
+	return p.nes.loadState(r, false)
+}
+
+func (p rewindMachine) RunFrame(frame movie.Frame) {
+	p.nes.applyCommands(frame.Commands)
+	p.nes.joypads.SetInput(frame.Input)
+	p.nes.runFrame()
+}
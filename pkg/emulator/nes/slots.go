@@ -0,0 +1,95 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/datadir"
+	"github.com/vfreex/gones/pkg/emulator/ppu"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	SAVE_SLOTS       = 10
+	THUMBNAIL_WIDTH  = SCREEN_WIDTH / 2
+	THUMBNAIL_HEIGHT = SCREEN_HEIGHT / 2
+)
+
+// SaveSlots stores quick-save states of a ROM in numbered slots,
+// each with a PNG thumbnail of the screen at the time of saving.
+type SaveSlots struct {
+	dir string
+}
+
+func NewSaveSlots(dataDir string, romHash RomHash) *SaveSlots {
+	return &SaveSlots{dir: datadir.RomDir(dataDir, "states", romHash[:])}
+}
+
+func (p *SaveSlots) StatePath(slot int) string {
+	return filepath.Join(p.dir, fmt.Sprintf("slot-%02d.state", slot))
+}
+
+func (p *SaveSlots) ThumbnailPath(slot int) string {
+	return filepath.Join(p.dir, fmt.Sprintf("slot-%02d.png", slot))
+}
+
+func (p *SaveSlots) checkSlot(slot int) error {
+	if slot < 1 || slot > SAVE_SLOTS {
+		return fmt.Errorf("save slot %d is out of range [1, %d]", slot, SAVE_SLOTS)
+	}
+	return nil
+}
+
+func (p *SaveSlots) Save(slot int, nes NES, screen *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor) error {
+	if err := p.checkSlot(slot); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return err
+	}
+	state := &bytes.Buffer{}
+	if err := nes.SaveState(state); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p.StatePath(slot), state.Bytes(), 0644); err != nil {
+		return err
+	}
+	thumbnail := &bytes.Buffer{}
+	if err := png.Encode(thumbnail, makeThumbnail(screen)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.ThumbnailPath(slot), thumbnail.Bytes(), 0644)
+}
+
+func (p *SaveSlots) Load(slot int, nes NES) error {
+	if err := p.checkSlot(slot); err != nil {
+		return err
+	}
+	state, err := os.Open(p.StatePath(slot))
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	return nes.LoadState(state)
+}
+
+// HasState reports whether something was saved in the slot.
+func (p *SaveSlots) HasState(slot int) bool {
+	_, err := os.Stat(p.StatePath(slot))
+	return err == nil
+}
+
+func makeThumbnail(screen *[SCREEN_HEIGHT][SCREEN_WIDTH]ppu.RBGColor) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, THUMBNAIL_WIDTH, THUMBNAIL_HEIGHT))
+	for y := 0; y < THUMBNAIL_HEIGHT; y++ {
+		for x := 0; x < THUMBNAIL_WIDTH; x++ {
+			pixel := screen[y*SCREEN_HEIGHT/THUMBNAIL_HEIGHT][x*SCREEN_WIDTH/THUMBNAIL_WIDTH]
+			img.SetRGBA(x, y, color.RGBA{R: byte(pixel >> 16), G: byte(pixel >> 8), B: byte(pixel >> 0), A: 0xff})
+		}
+	}
+	return img
+}
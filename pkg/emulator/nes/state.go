@@ -0,0 +1,182 @@
+package nes
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/savestate"
+	"io"
+)
+
+// chunks of a NES save state, tag and version
+const (
+	STATE_CHUNK_INFO   = "INFO"
+	STATE_CHUNK_CPU    = "CPU "
+	STATE_CHUNK_RAM    = "RAM "
+	STATE_CHUNK_PPU    = "PPU "
+	STATE_CHUNK_CIRAM  = "VRAM"
+	STATE_CHUNK_JOYPAD = "JOYP"
+	STATE_CHUNK_MAPPER = "MAPR"
+	STATE_CHUNK_CLOCK  = "CLCK"
+
+	STATE_CHUNK_VERSION = 1
+	// PRG-RAM is sized from the cartridge since version 2, rather than a fixed dump of $4020-$7FFF
+	STATE_CHUNK_MAPPER_VERSION = 2
+)
+
+type RomHash [sha1.Size]byte
+
+func hashRom(rom *cartridge.Cartridge) RomHash {
+	h := sha1.New()
+	h.Write(rom.PrgBin)
+	h.Write(rom.ChrBin)
+	if rom.Mapper == ines.MAPPER_FDS {
+		// every disk runs on the same BIOS
+		h.Write(rom.Extra)
+	}
+	var hash RomHash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// stateInfo identifies the cartridge a state belongs to
+type stateInfo struct {
+	romHash *RomHash
+}
+
+func (p stateInfo) SaveState(w io.Writer) error {
+	_, err := w.Write(p.romHash[:])
+	return err
+}
+
+func (p stateInfo) LoadState(r io.Reader) error {
+	var hash RomHash
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return err
+	}
+	if hash != *p.romHash {
+		return fmt.Errorf("save state belongs to another ROM (SHA-1 %x)", hash)
+	}
+	return nil
+}
+
+// clockState is the phase of the PPU relative to the CPU, which only matters on PAL
+type clockState struct {
+	masterClock *int
+}
+
+func (p clockState) SaveState(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, int32(*p.masterClock))
+}
+
+func (p clockState) LoadState(r io.Reader) error {
+	var masterClock int32
+	if err := binary.Read(r, binary.LittleEndian, &masterClock); err != nil {
+		return err
+	}
+	*p.masterClock = int(masterClock)
+	return nil
+}
+
+type stateChunk struct {
+	tag       string
+	component savestate.Stateful
+	// version written, older versions can't be loaded
+	version uint16
+	// states saved before the chunk was added don't have it
+	optional bool
+}
+
+func (nes *NESImpl) stateChunks() []stateChunk {
+	return []stateChunk{
+		{STATE_CHUNK_INFO, stateInfo{&nes.romHash}, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_CPU, nes.cpu, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_RAM, nes.ram, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_PPU, nes.ppu, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_CIRAM, nes.vram, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_JOYPAD, nes.joypads, STATE_CHUNK_VERSION, false},
+		{STATE_CHUNK_MAPPER, nes.mapper, STATE_CHUNK_MAPPER_VERSION, false},
+		{STATE_CHUNK_CLOCK, clockState{&nes.masterClock}, STATE_CHUNK_VERSION, true},
+	}
+}
+
+func (nes *NESImpl) SaveState(w io.Writer) error {
+	if nes.mapper == nil {
+		return fmt.Errorf("no cartridge is loaded")
+	}
+	sw, err := savestate.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range nes.stateChunks() {
+		if err := sw.WriteChunk(chunk.tag, chunk.version, chunk.component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (nes *NESImpl) LoadState(r io.Reader) error {
+	if err := nes.loadState(r, true); err != nil {
+		return err
+	}
+	// the history leads to the replaced state, not to the loaded one
+	nes.rewind.Reset()
+	return nil
+}
+
+// loadState restores a state, rolling back to the current one if it fails to load when rollback is set.
+// States taken by the emulator itself, such as those of the rewind buffer, can't fail halfway and skip the snapshot.
+func (nes *NESImpl) loadState(r io.Reader, rollback bool) error {
+	if nes.mapper == nil {
+		return fmt.Errorf("no cartridge is loaded")
+	}
+	sr, err := savestate.NewReader(r)
+	if err != nil {
+		return err
+	}
+	chunks := nes.stateChunks()
+	for _, chunk := range chunks {
+		if !sr.HasChunk(chunk.tag) && chunk.optional {
+			continue
+		}
+		if err := sr.CheckChunk(chunk.tag, chunk.version, chunk.version); err != nil {
+			return err
+		}
+	}
+	// check the state belongs to the loaded cartridge before touching anything
+	if err := sr.ReadChunk(STATE_CHUNK_INFO, chunks[0].version, chunks[0].component); err != nil {
+		return err
+	}
+	if !rollback {
+		return nes.loadChunks(sr, chunks[1:])
+	}
+	// keep the current state to roll back to, so a chunk failing to load doesn't leave the machine half restored
+	var snapshot bytes.Buffer
+	if err := nes.SaveState(&snapshot); err != nil {
+		return err
+	}
+	if err := nes.loadChunks(sr, chunks[1:]); err != nil {
+		if sr, rerr := savestate.NewReader(&snapshot); rerr == nil {
+			nes.loadChunks(sr, chunks[1:])
+		}
+		return err
+	}
+	return nil
+}
+
+func (nes *NESImpl) loadChunks(sr *savestate.Reader, chunks []stateChunk) error {
+	nes.masterClock = 0
+	for _, chunk := range chunks {
+		if !sr.HasChunk(chunk.tag) {
+			continue
+		}
+		if err := sr.ReadChunk(chunk.tag, chunk.version, chunk.component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
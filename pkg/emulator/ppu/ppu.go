@@ -4,10 +4,12 @@ import (
 	logger2 "github.com/vfreex/gones/pkg/emulator/common/logger"
 	"github.com/vfreex/gones/pkg/emulator/cpu"
 	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/region"
 )
 
 const (
-	ScanlinesPerFrame     = 262
+	ScanlinesPerFrame     = 262 // NTSC, see region.Timing for other regions
 	DotsPerScanline       = 341
 	VisualDotsPerScanline = 256
 	VisualScanlines       = 240
@@ -30,20 +32,57 @@ type PPUImpl struct {
 	currentSprites      [8]Sprite
 	currentSpritesCount int
 	NewFrameHandler     NewFrameHandler
+	timing              *region.Timing
 }
 
 var logger = logger2.GetLogger()
 
 func NewPPU(vram memory.AddressSpace, cpu *cpu.Cpu) *PPUImpl {
 	ppu := &PPUImpl{
-		vram: vram,
-		cpu:  cpu,
+		vram:   vram,
+		cpu:    cpu,
+		timing: &region.NTSC,
 		//secondaryOAM: ram.NewRAM(32),
 	}
 	ppu.registers = NewPPURegisters(ppu)
 	return ppu
 }
 
+// SetTiming sets the number of scanlines and when the vertical blank starts, NTSC by default.
+func (ppu *PPUImpl) SetTiming(timing *region.Timing) {
+	ppu.timing = timing
+}
+
+// FillOAM sets the power-on contents of the sprite RAM.
+func (ppu *PPUImpl) FillOAM(init *ram.Initializer) {
+	init.Fill(ppu.sprRam.data[:])
+}
+
+// PowerUp puts the PPU in its power-on state,
+// see http://wiki.nesdev.com/w/index.php/PPU_power_up_state
+func (ppu *PPUImpl) PowerUp() {
+	ppu.Reset()
+	r := &ppu.registers
+	r.status = 0
+	r.oamAddr = 0
+	r.v = 0
+	ppu.scanline = 0
+	ppu.dotInScanline = 0
+	ppu.frame = 0
+}
+
+// Reset puts the PPU in its state after the reset button is pressed.
+// OAM, palette and VRAM are left unchanged.
+func (ppu *PPUImpl) Reset() {
+	r := &ppu.registers
+	r.ctrl = 0
+	r.mask = 0
+	r.t = 0
+	r.x = 0
+	r.w = false
+	r.latchCache = 0
+}
+
 func (ppu *PPUImpl) MapToCPUAddressSpace(as memory.AddressSpace) {
 	as.AddMapping(0x2000, 0x2000,
 		memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, &ppu.registers, func(addr memory.Ptr) memory.Ptr {
@@ -5,15 +5,15 @@ import (
 )
 
 // The logical screen resolution processed by the PPU is 256x240 pixels
-// The PPU renders 262 scanlines per frame.
-// Each scanline lasts for 341 PPU clock cycles (113.667 CPU clock cycles; 1 CPU cycle = 3 PPU cycles),
+// The PPU renders 262 scanlines per frame (312 on PAL and Dendy).
+// Each scanline lasts for 341 PPU clock cycles (113.667 CPU clock cycles; 1 CPU cycle = 3 PPU cycles, 3.2 on PAL),
 // with each clock cycle producing one pixel
 
 func (ppu *PPUImpl) renderSprites() {
 	// http://wiki.nesdev.com/w/index.php/PPU_sprite_evaluation
 	dot := ppu.dotInScanline
 	y := ppu.scanline //- 21
-	if y == 261 {
+	if y == ppu.timing.PreRenderScanline() {
 		y = 255
 	}
 	switch {
@@ -56,9 +56,19 @@ func (ppu *PPUImpl) renderSprites() {
 			logger.Debugf("renderSprites: Scanline #%d has %d sprites.", y, ppu.spriteCount)
 		}
 	case dot >= 257 && dot <= 320:
-		// sprite fetches
+		// sprite fetches, only while rendering
+		if ppu.registers.mask&(PPUMask_BackgroundVisibility|PPUMask_SpriteVisibility) == 0 {
+			break
+		}
 		i := (dot - 257) / 8
 		if i >= ppu.spriteCount {
+			// empty slots fetch tile $FF, mappers watching the PPU address bus like MMC3 see them
+			switch (dot - 257) % 8 {
+			case 5:
+				ppu.vram.Peek(ppu.emptySpriteTileAddr())
+			case 7:
+				ppu.vram.Peek(ppu.emptySpriteTileAddr() + 8)
+			}
 			break
 		}
 		sprite := &ppu.sprites[i]
@@ -101,6 +111,18 @@ func (ppu *PPUImpl) spriteTileAddr(sprite *Sprite) memory.Ptr {
 	return addr
 }
 
+// emptySpriteTileAddr returns the address of the pattern of tile $FF, fetched for the empty sprite slots.
+func (ppu *PPUImpl) emptySpriteTileAddr() memory.Ptr {
+	if ppu.registers.ctrl&PPUCtrl_SpriteSize != 0 {
+		// 8 * 16 sprite, odd tiles in the second pattern table
+		return 0x1000 | 0xfe*16
+	}
+	if ppu.registers.ctrl&PPUCtrl_SpritePatternTable != 0 {
+		return 0x1000 | 0xff*16
+	}
+	return 0xff * 16
+}
+
 func (ppu *PPUImpl) fillShifters() {
 	ppu.registers.bgHighShift = ppu.registers.bgHighShift&0xff00 | uint16(ppu.registers.bgHighLatch)
 	ppu.registers.bgLowShift = ppu.registers.bgLowShift&0xff00 | uint16(ppu.registers.bgLowLatch)
@@ -213,7 +235,10 @@ func (ppu *PPUImpl) fetchBgTileRow(step int) {
 			highAddr |= 0x1000
 		}
 		ppu.registers.bgHighLatch = ppu.vram.Peek(highAddr)
-		logger.Debugf("at (%v, %v): v=%v", ppu.scanline, ppu.dotInScanline, ppu.registers.v.String())
+		if logger.DebugEnabled() {
+			// formatting v is as costly as the rest of the dot, skip it unless logged
+			logger.Debugf("at (%v, %v): v=%v", ppu.scanline, ppu.dotInScanline, ppu.registers.v.String())
+		}
 	}
 }
 
@@ -222,8 +247,9 @@ func (ppu *PPUImpl) Step() {
 	// http://wiki.nesdev.com/w/index.php/File:Ntsc_timing.png
 	scanline := ppu.scanline
 	dot := ppu.dotInScanline
+	preRenderScanline := ppu.timing.PreRenderScanline()
 	switch {
-	case scanline == 261: // pre
+	case scanline == preRenderScanline: // pre
 		switch {
 		case dot == 1:
 			ppu.registers.status &= ^(PPUStatus_Sprite0Hit | PPUStatus_SpriteOverflow | PPUStatus_VBlank)
@@ -233,7 +259,7 @@ func (ppu *PPUImpl) Step() {
 				ppu.registers.v.SetFineY(ppu.registers.t.FineY())
 				ppu.registers.v.SetNametable(ppu.registers.v.Nametable()&1 | ppu.registers.t.Nametable()&2)
 			}
-		case dot == 340 && ppu.frame&1 != 0 &&
+		case dot == 340 && ppu.frame&1 != 0 && ppu.timing.SkipOddFrameDot &&
 			ppu.registers.mask&(PPUMask_BackgroundVisibility|PPUMask_SpriteVisibility) != 0:
 			//on every odd frame, scanline 0, dot 0 is skipped
 			ppu.dotInScanline = 0
@@ -252,11 +278,12 @@ func (ppu *PPUImpl) Step() {
 		switch {
 		case dot == 0: // idle
 		case dot >= 1 && dot <= 256: // fetches 3rd..34th tile in scanline
-			if scanline == 261 {
+			if scanline == preRenderScanline {
 				break
 			}
-			ppu.fetchBgTileRow((dot - 1) % 8)
 			if ppu.registers.mask&(PPUMask_BackgroundVisibility|PPUMask_SpriteVisibility) != 0 {
+				// the PPU fetches only while rendering
+				ppu.fetchBgTileRow((dot - 1) % 8)
 				if dot%8 == 0 { // dots 8, 16, 24, ..., 256: increase coarseX
 					ppu.registers.v.IncreaseCoarseX()
 				}
@@ -271,8 +298,8 @@ func (ppu *PPUImpl) Step() {
 			}
 		case dot >= 257 && dot <= 320: // fetching the sprites on the next scanline
 		case dot >= 321 && dot <= 336: // fetching the first two tiles for the next scanline
-			ppu.fetchBgTileRow((dot - 321) % 8)
 			if ppu.registers.mask&(PPUMask_BackgroundVisibility|PPUMask_SpriteVisibility) != 0 {
+				ppu.fetchBgTileRow((dot - 321) % 8)
 				if dot%8 == 0 { // dots 328, 336: increase coarseX
 					ppu.registers.v.IncreaseCoarseX()
 				}
@@ -283,7 +310,7 @@ func (ppu *PPUImpl) Step() {
 		if dot == 0 && ppu.NewFrameHandler != nil {
 			ppu.NewFrameHandler(&ppu.RenderedBuffer, ppu.frame)
 		}
-	case scanline == 241: // VINT
+	case scanline == ppu.timing.VBlankScanline: // VINT
 		if dot == 1 {
 			ppu.registers.status |= PPUStatus_VBlank
 			if ppu.registers.ctrl&PPUCtrl_NMIOnVBlank != 0 {
@@ -296,8 +323,8 @@ end:
 	if ppu.dotInScanline >= DotsPerScanline {
 		ppu.dotInScanline %= DotsPerScanline
 		ppu.scanline++
-		if ppu.scanline >= ScanlinesPerFrame {
-			ppu.scanline %= ScanlinesPerFrame
+		if ppu.scanline >= ppu.timing.ScanlinesPerFrame {
+			ppu.scanline %= ppu.timing.ScanlinesPerFrame
 			ppu.frame++
 		}
 	}
@@ -65,3 +65,17 @@ func (p *SpriteAttr) Unmarshal(attr byte) {
 		VerticalFlip:       attr&byte(SpriteAttr_VerticalFlip) != 0,
 	}
 }
+
+func (p *SpriteAttr) Marshal() byte {
+	attr := byte(p.PaletteId) & byte(SpriteAttr_PaletteLow|SpriteAttr_PaletteHigh)
+	if p.BackgroundPriority {
+		attr |= byte(SpriteAttr_BackgroundPriority)
+	}
+	if p.HorizontalFlip {
+		attr |= byte(SpriteAttr_HorizontalFlip)
+	}
+	if p.VerticalFlip {
+		attr |= byte(SpriteAttr_VerticalFlip)
+	}
+	return attr
+}
@@ -0,0 +1,97 @@
+package ppu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type spriteState struct {
+	Id, X, Y, TileId        int32
+	Attr                    byte
+	TileRowLow, TileRowHigh byte
+}
+
+type ppuState struct {
+	LatchCache byte
+	Ctrl       PPUCtrl
+	Mask       PPUMask
+	Status     PPUStatus
+	OamAddr    byte
+	V, T       PPUAddrRegister
+	X          byte
+	W          bool
+
+	BgNameLatch, BgLowLatch, BgHighLatch byte
+	AttrLowLatch, AttrHighLatch          byte
+	BgHighShift, BgLowShift              uint16
+	AttrHighShift, AttrLowShift          uint16
+
+	Scanline, DotInScanline, Frame int32
+	SpriteCount                    int32
+	Sprites                        [8]spriteState
+	CurrentSpritesCount            int32
+	CurrentSprites                 [8]spriteState
+
+	Oam     [0x100]byte
+	Palette [0x20]Color
+}
+
+func (p *Sprite) state() spriteState {
+	return spriteState{
+		Id: int32(p.Id), X: int32(p.X), Y: int32(p.Y), TileId: int32(p.TileId),
+		Attr:       p.Attr.Marshal(),
+		TileRowLow: p.TileRowLow, TileRowHigh: p.TileRowHigh,
+	}
+}
+
+func (p *Sprite) setState(state *spriteState) {
+	p.Id, p.X, p.Y, p.TileId = int(state.Id), int(state.X), int(state.Y), int(state.TileId)
+	p.Attr.Unmarshal(state.Attr)
+	p.TileRowLow, p.TileRowHigh = state.TileRowLow, state.TileRowHigh
+}
+
+func (ppu *PPUImpl) SaveState(w io.Writer) error {
+	r := &ppu.registers
+	state := ppuState{
+		LatchCache: r.latchCache, Ctrl: r.ctrl, Mask: r.mask, Status: r.status, OamAddr: r.oamAddr,
+		V: r.v, T: r.t, X: r.x, W: r.w,
+		BgNameLatch: r.bgNameLatch, BgLowLatch: r.bgLowLatch, BgHighLatch: r.bgHighLatch,
+		AttrLowLatch: r.attrLowLatch, AttrHighLatch: r.attrHighLatch,
+		BgHighShift: r.bgHighShift, BgLowShift: r.bgLowShift,
+		AttrHighShift: r.attrHighShift, AttrLowShift: r.attrLowShift,
+		Scanline: int32(ppu.scanline), DotInScanline: int32(ppu.dotInScanline), Frame: int32(ppu.frame),
+		SpriteCount:         int32(ppu.spriteCount),
+		CurrentSpritesCount: int32(ppu.currentSpritesCount),
+		Oam:                 ppu.sprRam.data,
+		Palette:             ppu.Palette.entries,
+	}
+	for i := range ppu.sprites {
+		state.Sprites[i] = ppu.sprites[i].state()
+		state.CurrentSprites[i] = ppu.currentSprites[i].state()
+	}
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (ppu *PPUImpl) LoadState(rd io.Reader) error {
+	var state ppuState
+	if err := binary.Read(rd, binary.LittleEndian, &state); err != nil {
+		return err
+	}
+	r := &ppu.registers
+	r.latchCache, r.ctrl, r.mask, r.status, r.oamAddr = state.LatchCache, state.Ctrl, state.Mask, state.Status, state.OamAddr
+	r.v, r.t, r.x, r.w = state.V, state.T, state.X, state.W
+	r.bgNameLatch, r.bgLowLatch, r.bgHighLatch = state.BgNameLatch, state.BgLowLatch, state.BgHighLatch
+	r.attrLowLatch, r.attrHighLatch = state.AttrLowLatch, state.AttrHighLatch
+	r.bgHighShift, r.bgLowShift = state.BgHighShift, state.BgLowShift
+	r.attrHighShift, r.attrLowShift = state.AttrHighShift, state.AttrLowShift
+	ppu.scanline, ppu.dotInScanline, ppu.frame = int(state.Scanline), int(state.DotInScanline), int(state.Frame)
+	ppu.spriteCount = int(state.SpriteCount)
+	ppu.currentSpritesCount = int(state.CurrentSpritesCount)
+	for i := range ppu.sprites {
+		ppu.sprites[i].setState(&state.Sprites[i])
+		ppu.currentSprites[i].setState(&state.CurrentSprites[i])
+	}
+	ppu.sprRam.data = state.Oam
+	ppu.Palette.entries = state.Palette
+	return nil
+}
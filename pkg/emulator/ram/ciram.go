@@ -29,6 +29,10 @@ func (p *CIRam) SetNametableMirroring(logical, physical int) {
 	p.mirroringMap[logical] = physical
 }
 
+func (p *CIRam) Fill(init *Initializer) {
+	init.Fill(p.ram[:])
+}
+
 func (p *CIRam) mapAddr(addr memory.Ptr) memory.Ptr {
 	logical := (addr & 0xfff) / 0x400
 	physical := p.mirroringMap[logical]
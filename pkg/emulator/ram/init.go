@@ -0,0 +1,77 @@
+package ram
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// The contents of RAM are unreliable at power-on.
+// Emulators usually pick a consistent state, which may hide bugs in programs relying on it,
+// so the power-on state is configurable.
+// http://wiki.nesdev.com/w/index.php/CPU_power_up_state
+
+type InitPattern int
+
+const (
+	INIT_ZEROS   InitPattern = iota // all $00
+	INIT_ONES                       // all $FF
+	INIT_PATTERN                    // FCEUX style: 4 bytes of $00 followed by 4 bytes of $FF
+	INIT_RANDOM                     // random bytes from a seed
+)
+
+var initPatternNames = map[InitPattern]string{
+	INIT_ZEROS:   "zeros",
+	INIT_ONES:    "ff",
+	INIT_PATTERN: "pattern",
+	INIT_RANDOM:  "random",
+}
+
+func (p InitPattern) String() string {
+	if name, ok := initPatternNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("InitPattern(%d)", int(p))
+}
+
+func ParseInitPattern(name string) (InitPattern, error) {
+	for pattern, patternName := range initPatternNames {
+		if patternName == name {
+			return pattern, nil
+		}
+	}
+	return INIT_ZEROS, fmt.Errorf("unknown RAM init pattern %q, expecting zeros, ff, pattern or random", name)
+}
+
+// Initializer fills memories with their power-on contents.
+// With INIT_RANDOM, filling the same memories in the same order with the same seed
+// always gives the same contents.
+type Initializer struct {
+	pattern InitPattern
+	rnd     *rand.Rand
+}
+
+func NewInitializer(pattern InitPattern, seed int64) *Initializer {
+	return &Initializer{
+		pattern: pattern,
+		rnd:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (p *Initializer) Fill(data []byte) {
+	for i := range data {
+		switch p.pattern {
+		case INIT_ONES:
+			data[i] = 0xff
+		case INIT_PATTERN:
+			if i&4 != 0 {
+				data[i] = 0xff
+			} else {
+				data[i] = 0
+			}
+		case INIT_RANDOM:
+			data[i] = byte(p.rnd.Intn(0x100))
+		default:
+			data[i] = 0
+		}
+	}
+}
@@ -19,3 +19,7 @@ func (r *RAM) Peek(addr memory.Ptr) byte {
 func (r *RAM) Poke(addr memory.Ptr, val byte) {
 	r.data[addr] = val
 }
+
+func (r *RAM) Fill(init *Initializer) {
+	init.Fill(r.data)
+}
@@ -15,3 +15,23 @@ func TestRamWriteRead(t *testing.T) {
 		t.Error("For", ptr, "expected", e, "got", v)
 	}
 }
+
+func TestInitializer(t *testing.T) {
+	r := NewRAM(16)
+	r.Fill(NewInitializer(INIT_PATTERN, 0))
+	expected := []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}
+	for i, e := range expected {
+		if v := r.Peek(memory.Ptr(i)); v != e {
+			t.Error("For", i, "expected", e, "got", v)
+		}
+	}
+
+	r1, r2 := NewRAM(64), NewRAM(64)
+	r1.Fill(NewInitializer(INIT_RANDOM, 42))
+	r2.Fill(NewInitializer(INIT_RANDOM, 42))
+	for i := memory.Ptr(0); i < 64; i++ {
+		if r1.Peek(i) != r2.Peek(i) {
+			t.Fatal("random contents with the same seed differ at", i)
+		}
+	}
+}
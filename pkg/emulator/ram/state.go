@@ -0,0 +1,41 @@
+package ram
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+func (r *RAM) SaveState(w io.Writer) error {
+	_, err := w.Write(r.data)
+	return err
+}
+
+func (r *RAM) LoadState(rd io.Reader) error {
+	_, err := io.ReadFull(rd, r.data)
+	return err
+}
+
+type ciramState struct {
+	Ram          [0x1000]byte
+	MirroringMap [4]uint8
+}
+
+func (p *CIRam) SaveState(w io.Writer) error {
+	state := ciramState{Ram: p.ram}
+	for i, physical := range p.mirroringMap {
+		state.MirroringMap[i] = uint8(physical)
+	}
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (p *CIRam) LoadState(r io.Reader) error {
+	var state ciramState
+	if err := binary.Read(r, binary.LittleEndian, &state); err != nil {
+		return err
+	}
+	p.ram = state.Ram
+	for i, physical := range state.MirroringMap {
+		p.SetNametableMirroring(i, int(physical))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package region describes the timing of the NTSC, PAL and Dendy consoles.
+// http://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+package region
+
+import (
+	"fmt"
+)
+
+type Region int
+
+const (
+	REGION_AUTO  Region = iota // taken from the cartridge header
+	REGION_NTSC                // North America, Japan
+	REGION_PAL                 // Europe, Australia
+	REGION_DENDY               // PAL famiclones: PAL frame rate with NTSC-like CPU/PPU ratio
+)
+
+var regionNames = map[Region]string{
+	REGION_AUTO:  "auto",
+	REGION_NTSC:  "ntsc",
+	REGION_PAL:   "pal",
+	REGION_DENDY: "dendy",
+}
+
+func (p Region) String() string {
+	if name, ok := regionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Region(%d)", int(p))
+}
+
+func ParseRegion(name string) (Region, error) {
+	for region, regionName := range regionNames {
+		if regionName == name {
+			return region, nil
+		}
+	}
+	return REGION_AUTO, fmt.Errorf("unknown region %q, expecting auto, ntsc, pal or dendy", name)
+}
+
+// Timing gives the clocks of a console, all derived from its master clock.
+type Timing struct {
+	Region Region
+	// master clock in Hz
+	MasterClockRate float64
+	// master clock cycles per CPU and PPU cycle
+	CpuClockDivider int
+	PpuClockDivider int
+	// the last scanline is the pre-render scanline
+	ScanlinesPerFrame int
+	// scanline where the vertical blank starts and NMI occurs
+	VBlankScanline int
+	// the first dot of odd frames is skipped when rendering is enabled
+	SkipOddFrameDot bool
+	// APU noise channel periods and DMC rates in CPU cycles
+	NoisePeriods [16]uint16
+	DMCRates     [16]uint16
+}
+
+const DotsPerScanline = 341
+
+var ntscNoisePeriods = [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+var ntscDMCRates = [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54}
+
+var NTSC = Timing{
+	Region:            REGION_NTSC,
+	MasterClockRate:   236.25e6 / 11,
+	CpuClockDivider:   12,
+	PpuClockDivider:   4,
+	ScanlinesPerFrame: 262,
+	VBlankScanline:    241,
+	SkipOddFrameDot:   true,
+	NoisePeriods:      ntscNoisePeriods,
+	DMCRates:          ntscDMCRates,
+}
+
+var PAL = Timing{
+	Region:            REGION_PAL,
+	MasterClockRate:   26601712.5,
+	CpuClockDivider:   16,
+	PpuClockDivider:   5,
+	ScanlinesPerFrame: 312,
+	VBlankScanline:    241,
+	NoisePeriods:      [16]uint16{4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778},
+	DMCRates:          [16]uint16{398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50},
+}
+
+// Dendy runs the NTSC APU at its own CPU clock, and starts the vertical blank 50 scanlines
+// after the picture, so that games written for NTSC have the usual time before NMI.
+var Dendy = Timing{
+	Region:            REGION_DENDY,
+	MasterClockRate:   26601712.5,
+	CpuClockDivider:   15,
+	PpuClockDivider:   5,
+	ScanlinesPerFrame: 312,
+	VBlankScanline:    291,
+	NoisePeriods:      ntscNoisePeriods,
+	DMCRates:          ntscDMCRates,
+}
+
+// TimingOf returns the timing of a region, NTSC for REGION_AUTO.
+func TimingOf(region Region) *Timing {
+	switch region {
+	case REGION_PAL:
+		return &PAL
+	case REGION_DENDY:
+		return &Dendy
+	default:
+		return &NTSC
+	}
+}
+
+func (p *Timing) CpuClockRate() float64 {
+	return p.MasterClockRate / float64(p.CpuClockDivider)
+}
+
+func (p *Timing) PpuClockRate() float64 {
+	return p.MasterClockRate / float64(p.PpuClockDivider)
+}
+
+// PreRenderScanline is the last scanline of a frame.
+func (p *Timing) PreRenderScanline() int {
+	return p.ScanlinesPerFrame - 1
+}
+
+// CpuCyclesPerFrame is the average number of CPU cycles in a frame, rounded down.
+func (p *Timing) CpuCyclesPerFrame() int {
+	return DotsPerScanline * p.ScanlinesPerFrame * p.PpuClockDivider / p.CpuClockDivider
+}
+
+// FrameRate is the number of frames per second.
+func (p *Timing) FrameRate() float64 {
+	return p.PpuClockRate() / float64(DotsPerScanline*p.ScanlinesPerFrame)
+}
@@ -0,0 +1,30 @@
+package region
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTiming(t *testing.T) {
+	tests := []struct {
+		timing            *Timing
+		cpuCyclesPerFrame int
+		frameRate         float64
+		cpuClockRate      float64
+	}{
+		{&NTSC, 29780, 60.0988, 1789773},
+		{&PAL, 33247, 50.0070, 1662607},
+		{&Dendy, 35464, 50.0070, 1773448},
+	}
+	for _, test := range tests {
+		if cycles := test.timing.CpuCyclesPerFrame(); cycles != test.cpuCyclesPerFrame {
+			t.Errorf("%v: expected %d CPU cycles per frame, got %d", test.timing.Region, test.cpuCyclesPerFrame, cycles)
+		}
+		if rate := test.timing.FrameRate(); math.Abs(rate-test.frameRate) > 0.001 {
+			t.Errorf("%v: expected %v frames per second, got %v", test.timing.Region, test.frameRate, rate)
+		}
+		if rate := test.timing.CpuClockRate(); math.Abs(rate-test.cpuClockRate) > 1 {
+			t.Errorf("%v: expected a CPU clock of %v Hz, got %v", test.timing.Region, test.cpuClockRate, rate)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package rewind
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Consecutive snapshots differ in few bytes, so a snapshot is stored as the XOR against its neighbour,
+// run-length encoded as a sequence of:
+//   uvarint  number of unchanged (zero) bytes
+//   uvarint  number of changed bytes
+//   ...      the changed bytes
+
+// xorDelta encodes a XOR b. Both must have the same length.
+func xorDelta(a, b []byte) []byte {
+	var out []byte
+	var buf [binary.MaxVarintLen64]byte
+	for i := 0; i < len(a); {
+		zeros := 0
+		for i < len(a) && a[i] == b[i] {
+			zeros++
+			i++
+		}
+		start := i
+		for i < len(a) && a[i] != b[i] {
+			i++
+		}
+		out = append(out, buf[:binary.PutUvarint(buf[:], uint64(zeros))]...)
+		out = append(out, buf[:binary.PutUvarint(buf[:], uint64(i-start))]...)
+		for j := start; j < i; j++ {
+			out = append(out, a[j]^b[j])
+		}
+	}
+	return out
+}
+
+// applyDelta XORs an encoded delta into data in place.
+func applyDelta(data, delta []byte) error {
+	pos := 0
+	for len(delta) > 0 {
+		zeros, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return fmt.Errorf("corrupted rewind delta")
+		}
+		delta = delta[n:]
+		changed, n := binary.Uvarint(delta)
+		if n <= 0 || uint64(len(delta)-n) < changed {
+			return fmt.Errorf("corrupted rewind delta")
+		}
+		delta = delta[n:]
+		pos += int(zeros)
+		if pos+int(changed) > len(data) {
+			return fmt.Errorf("rewind delta exceeds snapshot size %d", len(data))
+		}
+		for j := 0; j < int(changed); j++ {
+			data[pos+j] ^= delta[j]
+		}
+		pos += int(changed)
+		delta = delta[changed:]
+	}
+	return nil
+}
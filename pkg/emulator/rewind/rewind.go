@@ -0,0 +1,156 @@
+package rewind
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"github.com/vfreex/gones/pkg/emulator/movie"
+	"github.com/vfreex/gones/pkg/emulator/savestate"
+)
+
+// Rewind snapshots the machine every few frames into a ring buffer and records the commands and input of every frame.
+// Stepping back one frame restores the nearest snapshot before it
+// and emulates the frames in between again with the recorded commands and input.
+//
+// Only the newest snapshot is kept in full. Every older snapshot is stored as a delta against
+// the next newer one, so stepping back walks the deltas backwards,
+// and the oldest snapshots can be dropped when running out of memory budget.
+
+const (
+	DEFAULT_INTERVAL      = 4
+	DEFAULT_MEMORY_BUDGET = 16 * 1024 * 1024
+)
+
+// bytes taken by the commands and input of a frame
+const inputSize = 1 + len(joypad.Input{})
+
+// Machine is the emulator being rewound.
+type Machine interface {
+	savestate.Stateful
+	// RunFrame applies the commands of a frame, then emulates it with its input.
+	RunFrame(frame movie.Frame)
+}
+
+type Config struct {
+	// frames between snapshots, DEFAULT_INTERVAL if 0
+	Interval int
+	// bytes used by snapshots and recorded input, DEFAULT_MEMORY_BUDGET if 0
+	MemoryBudget int
+}
+
+type snapshot struct {
+	frame int
+	// delta against the next newer snapshot, nil for the newest one
+	delta []byte
+	// commands and input of the frames from this snapshot on
+	inputs []movie.Frame
+}
+
+type Buffer struct {
+	config    Config
+	machine   Machine
+	snapshots []snapshot // oldest first
+	newest    []byte     // full state of the newest snapshot
+	frame     int
+	used      int
+}
+
+func NewBuffer(machine Machine, config Config) *Buffer {
+	if config.Interval <= 0 {
+		config.Interval = DEFAULT_INTERVAL
+	}
+	if config.MemoryBudget <= 0 {
+		config.MemoryBudget = DEFAULT_MEMORY_BUDGET
+	}
+	return &Buffer{config: config, machine: machine}
+}
+
+// Frame returns the number of frames recorded since the buffer was created or reset.
+func (p *Buffer) Frame() int {
+	return p.frame
+}
+
+// Reset forgets the history, e.g. after loading a state.
+func (p *Buffer) Reset() {
+	p.snapshots = nil
+	p.newest = nil
+	p.used = 0
+}
+
+// Record must be called at the start of a frame, before its commands are applied.
+func (p *Buffer) Record(frame movie.Frame) error {
+	if len(p.snapshots) == 0 || p.frame-p.snapshots[len(p.snapshots)-1].frame >= p.config.Interval {
+		if err := p.takeSnapshot(); err != nil {
+			return err
+		}
+	}
+	last := &p.snapshots[len(p.snapshots)-1]
+	last.inputs = append(last.inputs, frame)
+	p.used += inputSize
+	p.frame++
+	return nil
+}
+
+func (p *Buffer) takeSnapshot() error {
+	buf := &bytes.Buffer{}
+	if err := p.machine.SaveState(buf); err != nil {
+		return err
+	}
+	state := buf.Bytes()
+	if len(p.snapshots) > 0 {
+		if len(state) != len(p.newest) {
+			// the layout of the state changed, e.g. another cartridge was loaded
+			p.Reset()
+		} else {
+			last := &p.snapshots[len(p.snapshots)-1]
+			last.delta = xorDelta(p.newest, state)
+			p.used += len(last.delta)
+		}
+	}
+	p.used += len(state) - len(p.newest)
+	p.newest = state
+	p.snapshots = append(p.snapshots, snapshot{frame: p.frame})
+	for p.used > p.config.MemoryBudget && len(p.snapshots) > 1 {
+		oldest := &p.snapshots[0]
+		p.used -= len(oldest.delta) + len(oldest.inputs)*inputSize
+		p.snapshots = p.snapshots[1:]
+	}
+	return nil
+}
+
+// CanStepBack reports whether there is history to step back to.
+func (p *Buffer) CanStepBack() bool {
+	return len(p.snapshots) > 0 && p.frame > p.snapshots[0].frame
+}
+
+// StepBack restores the machine to the beginning of the previous frame.
+func (p *Buffer) StepBack() error {
+	if !p.CanStepBack() {
+		return fmt.Errorf("no more rewind history")
+	}
+	target := p.frame - 1
+	// drop the snapshots taken after the target frame
+	for p.snapshots[len(p.snapshots)-1].frame > target {
+		dropped := &p.snapshots[len(p.snapshots)-1]
+		p.used -= len(dropped.inputs) * inputSize
+		p.snapshots = p.snapshots[:len(p.snapshots)-1]
+		last := &p.snapshots[len(p.snapshots)-1]
+		if err := applyDelta(p.newest, last.delta); err != nil {
+			return err
+		}
+		p.used -= len(last.delta)
+		last.delta = nil
+	}
+	last := &p.snapshots[len(p.snapshots)-1]
+	if err := p.machine.LoadState(bytes.NewReader(p.newest)); err != nil {
+		return err
+	}
+	replay := target - last.frame
+	for _, frame := range last.inputs[:replay] {
+		p.machine.RunFrame(frame)
+	}
+	p.used -= (len(last.inputs) - replay) * inputSize
+	last.inputs = last.inputs[:replay]
+	p.frame = target
+	return nil
+}
@@ -0,0 +1,110 @@
+package rewind
+
+import (
+	"bytes"
+	"github.com/vfreex/gones/pkg/emulator/joypad"
+	"github.com/vfreex/gones/pkg/emulator/movie"
+	"io"
+	"testing"
+)
+
+// testMachine has some memory that every frame changes a little depending on the commands and input
+type testMachine struct {
+	frame  int
+	memory [256]byte
+}
+
+func (p *testMachine) SaveState(w io.Writer) error {
+	if _, err := w.Write([]byte{byte(p.frame)}); err != nil {
+		return err
+	}
+	_, err := w.Write(p.memory[:])
+	return err
+}
+
+func (p *testMachine) LoadState(r io.Reader) error {
+	var frame [1]byte
+	if _, err := io.ReadFull(r, frame[:]); err != nil {
+		return err
+	}
+	p.frame = int(frame[0])
+	_, err := io.ReadFull(r, p.memory[:])
+	return err
+}
+
+func (p *testMachine) RunFrame(frame movie.Frame) {
+	if frame.Commands&movie.COMMAND_SOFT_RESET != 0 {
+		p.memory[1] = 0
+	}
+	p.memory[p.frame%len(p.memory)] += frame.Input[0] + 1
+	p.memory[0] ^= frame.Input[1]
+	p.frame++
+}
+
+func TestDelta(t *testing.T) {
+	a := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []byte{1, 2, 0, 4, 5, 0, 0, 8}
+	delta := xorDelta(a, b)
+	c := append([]byte{}, b...)
+	if err := applyDelta(c, delta); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, c) {
+		t.Fatalf("expected %v, got %v", a, c)
+	}
+}
+
+func TestStepBack(t *testing.T) {
+	machine := &testMachine{}
+	buffer := NewBuffer(machine, Config{Interval: 3})
+	var history [][]byte
+	for frame := 0; frame < 20; frame++ {
+		state := &bytes.Buffer{}
+		machine.SaveState(state)
+		history = append(history, state.Bytes())
+		input := movie.Frame{Input: joypad.Input{byte(frame), byte(frame * 7)}}
+		if frame%5 == 2 {
+			input.Commands = movie.COMMAND_SOFT_RESET
+		}
+		if err := buffer.Record(input); err != nil {
+			t.Fatal(err)
+		}
+		machine.RunFrame(input)
+	}
+	for frame := 19; frame >= 0; frame-- {
+		if err := buffer.StepBack(); err != nil {
+			t.Fatalf("error stepping back to frame %d: %v", frame, err)
+		}
+		state := &bytes.Buffer{}
+		machine.SaveState(state)
+		if !bytes.Equal(state.Bytes(), history[frame]) {
+			t.Fatalf("state after stepping back to frame %d differs", frame)
+		}
+	}
+	if buffer.CanStepBack() {
+		t.Fatal("expected no more history before the first frame")
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	machine := &testMachine{}
+	buffer := NewBuffer(machine, Config{Interval: 1, MemoryBudget: 1024})
+	for frame := 0; frame < 1000; frame++ {
+		input := movie.Frame{Input: joypad.Input{byte(frame), 0}}
+		buffer.Record(input)
+		machine.RunFrame(input)
+	}
+	if buffer.used > 1024 {
+		t.Fatalf("expected at most 1024 bytes used, got %d", buffer.used)
+	}
+	steps := 0
+	for buffer.CanStepBack() {
+		if err := buffer.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+		steps++
+	}
+	if steps == 0 || steps >= 1000 {
+		t.Fatalf("expected the budget to keep some but not all history, got %d frames", steps)
+	}
+}
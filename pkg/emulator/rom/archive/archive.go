@@ -0,0 +1,148 @@
+// Package archive extracts ROM files from zip and gzip archives, so ROM sets can be kept compressed.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ZIP_MAGIC  = "PK\x03\x04"
+	GZIP_MAGIC = "\x1f\x8b"
+	// 7z archives are recognized to report them as unsupported
+	SEVEN_ZIP_MAGIC = "7z\xbc\xaf\x27\x1c"
+)
+
+// ROM_EXTENSIONS are the extensions of the ROM files looked for in archives.
+var ROM_EXTENSIONS = []string{".nes", ".unf", ".unif", ".fds", ".qd", ".nsf"}
+
+// File is a ROM file, read as is or extracted from an archive.
+type File struct {
+	// name of the file, or of the entry in the archive
+	Name string
+	Data []byte
+}
+
+// EntryError is returned when the ROM entry to extract from an archive can't be chosen.
+type EntryError struct {
+	Archive string
+	// the requested entry, empty if none was
+	Entry string
+	// the ROM entries of the archive
+	Entries []string
+}
+
+func (e *EntryError) Error() string {
+	switch {
+	case e.Entry != "":
+		return fmt.Sprintf("%s has no entry %q, ROM entries: %s", e.Archive, e.Entry, strings.Join(e.Entries, ", "))
+	case len(e.Entries) == 0:
+		return fmt.Sprintf("%s has no ROM entry", e.Archive)
+	default:
+		return fmt.Sprintf("%s has several ROM entries, choose one of: %s", e.Archive, strings.Join(e.Entries, ", "))
+	}
+}
+
+// Open reads a ROM file, extracting it from a zip or gzip archive.
+// The entry to extract from zip archives is chosen by name when there are several ROMs.
+func Open(fileName, entry string) (*File, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, filepath.Base(fileName), entry)
+}
+
+// Read is Open for a file already opened.
+func Read(r io.Reader, name, entry string) (*File, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte(ZIP_MAGIC)):
+		return readZip(data, name, entry)
+	case bytes.HasPrefix(data, []byte(GZIP_MAGIC)):
+		return readGzip(data, name)
+	case bytes.HasPrefix(data, []byte(SEVEN_ZIP_MAGIC)):
+		return nil, fmt.Errorf("%s: 7z archives are not supported, please extract the ROM or repack it as zip", name)
+	default:
+		return &File{Name: name, Data: data}, nil
+	}
+}
+
+// IsRom tells whether the name has one of the ROM_EXTENSIONS.
+func IsRom(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, romExt := range ROM_EXTENSIONS {
+		if ext == romExt {
+			return true
+		}
+	}
+	return false
+}
+
+func readZip(data []byte, name, entry string) (*File, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var roms []*zip.File
+	var romNames []string
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() && IsRom(f.Name) {
+			roms = append(roms, f)
+			romNames = append(romNames, f.Name)
+		}
+	}
+	sort.Strings(romNames)
+	var chosen *zip.File
+	for _, f := range roms {
+		if entry != "" && (f.Name == entry || filepath.Base(f.Name) == entry) {
+			chosen = f
+			break
+		}
+	}
+	if chosen == nil {
+		if entry != "" || len(roms) != 1 {
+			return nil, &EntryError{Archive: name, Entry: entry, Entries: romNames}
+		}
+		chosen = roms[0]
+	}
+	rc, err := chosen.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	defer rc.Close()
+	romData, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", name, chosen.Name, err)
+	}
+	return &File{Name: chosen.Name, Data: romData}, nil
+}
+
+func readGzip(data []byte, name string) (*File, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	defer r.Close()
+	romData, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	romName := r.Name
+	if romName == "" {
+		romName = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return &File{Name: romName, Data: romData}, nil
+}
@@ -0,0 +1,60 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	single := makeZip(t, map[string]string{"readme.txt": "hello", "games/game.nes": "NES\x1a"})
+	f, err := Read(bytes.NewReader(single), "game.zip", "")
+	if err != nil || f.Name != "games/game.nes" || string(f.Data) != "NES\x1a" {
+		t.Errorf("unexpected ROM %+v extracted from zip, error %v", f, err)
+	}
+
+	several := makeZip(t, map[string]string{"a.nes": "A", "b.fds": "B"})
+	if _, err := Read(bytes.NewReader(several), "games.zip", ""); err == nil {
+		t.Errorf("ambiguous entry accepted")
+	} else if entryErr, ok := err.(*EntryError); !ok || len(entryErr.Entries) != 2 {
+		t.Errorf("unexpected error %v", err)
+	}
+	if f, err := Read(bytes.NewReader(several), "games.zip", "b.fds"); err != nil || string(f.Data) != "B" {
+		t.Errorf("entry not extracted: %+v, %v", f, err)
+	}
+	if _, err := Read(bytes.NewReader(several), "games.zip", "c.nes"); err == nil {
+		t.Errorf("missing entry accepted")
+	}
+
+	gz := &bytes.Buffer{}
+	w := gzip.NewWriter(gz)
+	w.Write([]byte("NES\x1a"))
+	w.Close()
+	if f, err := Read(gz, "game.nes.gz", ""); err != nil || f.Name != "game.nes" || string(f.Data) != "NES\x1a" {
+		t.Errorf("unexpected ROM %+v extracted from gzip, error %v", f, err)
+	}
+
+	if _, err := Read(bytes.NewReader([]byte(SEVEN_ZIP_MAGIC+"\x00\x04")), "game.7z", ""); err == nil {
+		t.Errorf("7z archive accepted")
+	}
+	if f, err := Read(bytes.NewReader([]byte("NES\x1a")), "game.nes", ""); err != nil || f.Name != "game.nes" {
+		t.Errorf("unexpected ROM %+v, error %v", f, err)
+	}
+}
@@ -0,0 +1,87 @@
+// Package cartridge describes a game cartridge, whatever the file format it was loaded from.
+package cartridge
+
+import (
+	"encoding/json"
+	"github.com/vfreex/gones/pkg/emulator/region"
+)
+
+type Mirroring int
+
+// nametable mirroring wired on the board, which the mapper may change at runtime
+const (
+	MIRRORING_HORIZONTAL Mirroring = iota
+	MIRRORING_VERTICAL
+	MIRRORING_FOUR_SCREEN
+	MIRRORING_SINGLE_SCREEN_A
+	MIRRORING_SINGLE_SCREEN_B
+)
+
+func (m Mirroring) String() string {
+	switch m {
+	case MIRRORING_HORIZONTAL:
+		return "horizontal"
+	case MIRRORING_VERTICAL:
+		return "vertical"
+	case MIRRORING_FOUR_SCREEN:
+		return "four-screen"
+	case MIRRORING_SINGLE_SCREEN_A:
+		return "single-screen A"
+	case MIRRORING_SINGLE_SCREEN_B:
+		return "single-screen B"
+	default:
+		return "unknown"
+	}
+}
+
+// Cartridge is what the loaders of the ROM file formats produce, and the mappers are made from.
+type Cartridge struct {
+	// file format the cartridge was loaded from, like "iNES", "NES 2.0" or "UNIF"
+	Format string
+	// mapper number in the iNES numbering, and NES 2.0 submapper number
+	Mapper    int
+	Submapper int
+	// board name, only given by UNIF files
+	Board   string
+	PrgBin  []byte
+	ChrBin  []byte // empty when the board has CHR RAM only
+	Trainer []byte
+	// RAM sizes in bytes, NVRAM being battery-backed
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+	ChrNvramSize int
+	Battery      bool
+	Mirroring    Mirroring
+	Region       region.Region
+	// data after the ROMs, or the disk of the Famicom Disk System
+	Extra []byte
+	// header fields corrected from the ROM database
+	Corrections []string
+}
+
+func (p *Cartridge) String() string {
+	m := map[string]interface{}{
+		"format":          p.Format,
+		"mapper":          p.Mapper,
+		"submapper":       p.Submapper,
+		"prg_bytes":       len(p.PrgBin),
+		"chr_bytes":       len(p.ChrBin),
+		"trainer":         len(p.Trainer) > 0,
+		"prg_ram_bytes":   p.PrgRamSize,
+		"prg_nvram_bytes": p.PrgNvramSize,
+		"chr_ram_bytes":   p.ChrRamSize,
+		"chr_nvram_bytes": p.ChrNvramSize,
+		"battery":         p.Battery,
+		"mirroring":       p.Mirroring.String(),
+		"region":          p.Region.String(),
+	}
+	if p.Board != "" {
+		m["board"] = p.Board
+	}
+	if len(p.Extra) > 0 {
+		m["extra_bytes"] = len(p.Extra)
+	}
+	r, _ := json.Marshal(m)
+	return string(r)
+}
@@ -0,0 +1,318 @@
+package fds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"io"
+)
+
+/*
+The RAM adapter, http://wiki.nesdev.com/w/index.php/Family_Computer_Disk_System
+
+CPU $4020-$4026: timer IRQ, disk drive and mirroring control (write)
+CPU $4030-$4033: timer/disk status, read data, drive status and external connector (read)
+CPU $4040-$4097: sound, which isn't emulated
+CPU $6000-$DFFF: 32 KB of RAM, where the BIOS loads the programs from the disk
+CPU $E000-$FFFF: 8 KB BIOS ROM (disksys.rom)
+PPU $0000-$1FFF: 8 KB of CHR RAM
+*/
+
+const (
+	BIOS_SIZE = 8 * 1024
+	// CPU cycles for the drive to read or write a byte, at 96.4 kbit/s
+	BYTE_CYCLES = 149
+	// CPU cycles for the head to get back to the start of the disk
+	REWIND_CYCLES = 50000
+)
+
+func init() {
+	mappers.MapperConstructors[ines.MAPPER_FDS] = NewRAMAdapter
+}
+
+// RAMAdapter emulates the RAM adapter and its disk drive.
+type RAMAdapter struct {
+	bios   []byte
+	ram    [0x8000]byte
+	chrRam [0x2000]byte
+	// disk sides as on the disk surface, see toRaw
+	sides [][]byte
+	// written since loaded or saved
+	modified                          bool
+	nametableMirroringChangeListeners []mappers.NametableMirroringChangeListener
+	adapterState
+}
+
+// adapterState is what the registers and the drive keep, saved as is in save states.
+type adapterState struct {
+	TimerReload  uint16
+	TimerCounter uint16
+	TimerRepeat  bool
+	TimerEnabled bool
+	TimerIRQ     bool
+	// $4023
+	DiskIOEnabled bool
+	// $4025
+	MotorOn             bool
+	ResetTransfer       bool
+	ReadMode            bool
+	HorizontalMirroring bool
+	CRCControl          bool
+	DiskReady           bool
+	DiskIRQEnabled      bool
+	// drive
+	Side         int32 // inserted side, -1 if none
+	SelectedSide int32 // side inserted next
+	Position     int32
+	Delay        int32
+	EndOfHead    bool
+	Scanning     bool
+	GapEnded     bool
+	// CRC control of the previous byte
+	PreviousCRCControl bool
+	CRC                uint16
+	TransferComplete   bool
+	DiskIRQ            bool
+	ReadData           byte
+	WriteData          byte
+}
+
+// NewRAMAdapter makes the RAM adapter of a cartridge made by Image.Cartridge.
+func NewRAMAdapter(rom *cartridge.Cartridge) mappers.Mapper {
+	if len(rom.PrgBin) != BIOS_SIZE {
+		panic(fmt.Errorf("FDS BIOS has %d bytes, %d expected", len(rom.PrgBin), BIOS_SIZE))
+	}
+	image, err := NewImage(bytes.NewReader(rom.Extra))
+	if err != nil {
+		panic(fmt.Errorf("error reading FDS disk image: %v", err))
+	}
+	p := &RAMAdapter{bios: rom.PrgBin}
+	p.setSides(image)
+	p.Side, p.SelectedSide = 0, 0
+	p.PowerUp()
+	return p
+}
+
+// Cartridge describes the disk and the BIOS as a cartridge with the FDS mapper, as the NES loads cartridges.
+func (p *Image) Cartridge(bios []byte) (*cartridge.Cartridge, error) {
+	if len(bios) != BIOS_SIZE {
+		return nil, fmt.Errorf("FDS BIOS has %d bytes, %d expected", len(bios), BIOS_SIZE)
+	}
+	return &cartridge.Cartridge{
+		Format:     "FDS",
+		Mapper:     ines.MAPPER_FDS,
+		PrgBin:     bios,
+		PrgRamSize: 0x8000,
+		ChrRamSize: 0x2000,
+		Region:     region.REGION_NTSC,
+		Extra:      p.Bytes(),
+	}, nil
+}
+
+func (p *RAMAdapter) setSides(image *Image) {
+	p.sides = make([][]byte, len(image.Sides))
+	for i, side := range image.Sides {
+		p.sides[i] = toRaw(side)
+	}
+}
+
+func (p *RAMAdapter) AddNametableMirroringChangeListener(listener mappers.NametableMirroringChangeListener) {
+	p.nametableMirroringChangeListeners = append(p.nametableMirroringChangeListeners, listener)
+}
+
+func (p *RAMAdapter) FillPrgRam(init *ram.Initializer) {
+	init.Fill(p.ram[:])
+}
+
+func (p *RAMAdapter) FillChrRam(init *ram.Initializer) {
+	init.Fill(p.chrRam[:])
+}
+
+// PowerUp resets the registers, leaving the disk in the drive.
+func (p *RAMAdapter) PowerUp() {
+	side, selectedSide := p.Side, p.SelectedSide
+	p.adapterState = adapterState{Side: side, SelectedSide: selectedSide, EndOfHead: true}
+}
+
+func (p *RAMAdapter) IRQ() bool {
+	return p.TimerIRQ || p.DiskIRQ
+}
+
+func (p *RAMAdapter) ClockCpu(cycles int) {
+	for i := 0; i < cycles; i++ {
+		p.clockTimer()
+		p.clockDrive()
+	}
+}
+
+func (p *RAMAdapter) clockTimer() {
+	if !p.TimerEnabled {
+		return
+	}
+	if p.TimerCounter == 0 {
+		p.TimerIRQ = true
+		p.TimerCounter = p.TimerReload
+		if !p.TimerRepeat {
+			p.TimerEnabled = false
+		}
+	} else {
+		p.TimerCounter--
+	}
+}
+
+func (p *RAMAdapter) PeekPrg(addr memory.Ptr) byte {
+	switch {
+	case addr >= 0xe000:
+		return p.bios[addr-0xe000]
+	case addr >= 0x6000:
+		return p.ram[addr-0x6000]
+	}
+	switch addr {
+	case 0x4030:
+		var status byte
+		if p.TimerIRQ {
+			status |= 0x01
+		}
+		if p.TransferComplete {
+			status |= 0x02
+		}
+		if p.EndOfHead {
+			status |= 0x40
+		}
+		// CRC errors aren't reported, as reads from the drive are exact
+		p.TransferComplete, p.TimerIRQ, p.DiskIRQ = false, false, false
+		return status
+	case 0x4031:
+		p.TransferComplete, p.DiskIRQ = false, false
+		return p.ReadData
+	case 0x4032:
+		status := byte(0x40)
+		if p.Side < 0 {
+			// no disk, which can't be written
+			status |= 0x01 | 0x04
+		}
+		if p.Side < 0 || !p.Scanning {
+			status |= 0x02
+		}
+		return status
+	case 0x4033:
+		// battery is good
+		return 0x80
+	}
+	// open bus
+	return byte(addr >> 8)
+}
+
+func (p *RAMAdapter) PokePrg(addr memory.Ptr, val byte) {
+	switch {
+	case addr >= 0xe000:
+		return
+	case addr >= 0x6000:
+		p.ram[addr-0x6000] = val
+		return
+	}
+	switch addr {
+	case 0x4020:
+		p.TimerReload = p.TimerReload&0xff00 | uint16(val)
+	case 0x4021:
+		p.TimerReload = p.TimerReload&0x00ff | uint16(val)<<8
+	case 0x4022:
+		if !p.DiskIOEnabled {
+			return
+		}
+		p.TimerRepeat = val&0x01 != 0
+		p.TimerEnabled = val&0x02 != 0
+		if p.TimerEnabled {
+			p.TimerCounter = p.TimerReload
+		} else {
+			p.TimerIRQ = false
+		}
+	case 0x4023:
+		p.DiskIOEnabled = val&0x01 != 0
+		if !p.DiskIOEnabled {
+			p.TimerEnabled, p.TimerIRQ, p.DiskIRQ = false, false, false
+		}
+	case 0x4024:
+		p.WriteData = val
+		p.TransferComplete, p.DiskIRQ = false, false
+	case 0x4025:
+		p.MotorOn = val&0x01 != 0
+		p.ResetTransfer = val&0x02 != 0
+		p.ReadMode = val&0x04 != 0
+		p.setMirroring(val&0x08 != 0)
+		p.CRCControl = val&0x10 != 0
+		p.DiskReady = val&0x40 != 0
+		p.DiskIRQEnabled = val&0x80 != 0
+		p.DiskIRQ = false
+	}
+}
+
+func (p *RAMAdapter) setMirroring(horizontal bool) {
+	p.HorizontalMirroring = horizontal
+	mapping := [4]int{0, 1, 0, 1}
+	if horizontal {
+		mapping = [4]int{0, 0, 1, 1}
+	}
+	for logical, physical := range mapping {
+		for _, listener := range p.nametableMirroringChangeListeners {
+			listener(logical, physical)
+		}
+	}
+}
+
+func (p *RAMAdapter) PeekChr(addr memory.Ptr) byte {
+	if addr >= 0x2000 {
+		panic(fmt.Errorf("FDS CHR-RAM address 0x%x is not configured", addr))
+	}
+	return p.chrRam[addr]
+}
+
+func (p *RAMAdapter) PokeChr(addr memory.Ptr, val byte) {
+	if addr >= 0x2000 {
+		panic(fmt.Errorf("FDS CHR-RAM address 0x%x is not configured", addr))
+	}
+	p.chrRam[addr] = val
+}
+
+func (p *RAMAdapter) SaveState(w io.Writer) error {
+	if _, err := w.Write(p.ram[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(p.chrRam[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, &p.adapterState); err != nil {
+		return err
+	}
+	for _, side := range p.sides {
+		if _, err := w.Write(side); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *RAMAdapter) LoadState(r io.Reader) error {
+	if _, err := io.ReadFull(r, p.ram[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, p.chrRam[:]); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.adapterState); err != nil {
+		return err
+	}
+	for _, side := range p.sides {
+		if _, err := io.ReadFull(r, side); err != nil {
+			return err
+		}
+	}
+	p.setMirroring(p.HorizontalMirroring)
+	return nil
+}
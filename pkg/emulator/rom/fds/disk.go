@@ -0,0 +1,75 @@
+package fds
+
+// Disks are read and written by the drive as they are on the magnetic surface:
+// a gap of zeroes, then every block starts with the $80 gap terminator and ends with its CRC,
+// followed by another gap.
+const (
+	RAW_LEADING_GAP = 28300 / 8
+	RAW_BLOCK_GAP   = 976 / 8
+	// room for a full side of blocks with their gaps
+	RAW_SIDE_SIZE  = RAW_LEADING_GAP + SIDE_SIZE + 8192
+	GAP_TERMINATOR = 0x80
+)
+
+// toRaw lays out the blocks of a side as on the disk.
+func toRaw(side []byte) []byte {
+	raw := make([]byte, RAW_LEADING_GAP, RAW_SIDE_SIZE)
+	walkBlocks(side, false, func(block []byte) {
+		if len(raw)+1+len(block)+2+RAW_BLOCK_GAP > RAW_SIDE_SIZE {
+			return
+		}
+		raw = append(raw, GAP_TERMINATOR)
+		raw = append(raw, block...)
+		crc := blockCRC(block)
+		raw = append(raw, byte(crc), byte(crc>>8))
+		raw = append(raw, make([]byte, RAW_BLOCK_GAP)...)
+	})
+	return append(raw, make([]byte, RAW_SIDE_SIZE-len(raw))...)
+}
+
+// fromRaw extracts the blocks of a side written by the drive.
+func fromRaw(raw []byte) []byte {
+	blocks := make([]byte, 0, SIDE_SIZE)
+	fileSize := 0
+	for pos := 0; ; {
+		for pos < len(raw) && raw[pos] == 0 {
+			pos++
+		}
+		if pos+1 >= len(raw) || raw[pos] != GAP_TERMINATOR {
+			break
+		}
+		pos++
+		length := blockLength(raw[pos:], &fileSize)
+		if length == 0 || len(blocks)+length > SIDE_SIZE {
+			break
+		}
+		blocks = append(blocks, raw[pos:pos+length]...)
+		// skip the CRC
+		pos += length + 2
+	}
+	return append(blocks, make([]byte, SIDE_SIZE-len(blocks))...)
+}
+
+// blockCRC is the CRC the drive writes after a block, of the gap terminator and the block.
+func blockCRC(block []byte) uint16 {
+	crc := updateCRC(0, GAP_TERMINATOR)
+	for _, b := range block {
+		crc = updateCRC(crc, b)
+	}
+	return updateCRC(updateCRC(crc, 0), 0)
+}
+
+// updateCRC shifts a byte into the CRC-16 of the drive, polynomial $8408 fed from the top.
+func updateCRC(crc uint16, value byte) uint16 {
+	for bit := uint(0); bit < 8; bit++ {
+		carry := crc & 1
+		crc >>= 1
+		if carry != 0 {
+			crc ^= 0x8408
+		}
+		if value>>bit&1 != 0 {
+			crc ^= 0x8000
+		}
+	}
+	return crc
+}
@@ -0,0 +1,140 @@
+package fds
+
+import (
+	"fmt"
+	"io"
+)
+
+// clockDrive moves the disk under the head for a CPU cycle, transferring a byte every BYTE_CYCLES.
+func (p *RAMAdapter) clockDrive() {
+	if p.Side < 0 || !p.MotorOn {
+		p.EndOfHead = true
+		p.Scanning = false
+		return
+	}
+	if p.ResetTransfer && !p.Scanning {
+		return
+	}
+	if p.EndOfHead {
+		// the head goes back to the start of the disk
+		p.Delay = REWIND_CYCLES
+		p.EndOfHead = false
+		p.Position = 0
+		p.GapEnded = false
+		return
+	}
+	if p.Delay > 0 {
+		p.Delay--
+		return
+	}
+	p.Scanning = true
+	disk := p.sides[p.Side]
+	irq := p.DiskIRQEnabled
+	if p.ReadMode {
+		data := disk[p.Position]
+		if !p.PreviousCRCControl {
+			p.CRC = updateCRC(p.CRC, data)
+		}
+		if !p.DiskReady {
+			p.GapEnded = false
+			p.CRC = 0
+		} else if data != 0 && !p.GapEnded {
+			// the gap terminator isn't handed over
+			p.GapEnded = true
+			irq = false
+		}
+		if p.GapEnded {
+			p.TransferComplete = true
+			p.ReadData = data
+			if irq {
+				p.DiskIRQ = true
+			}
+		}
+	} else {
+		var data byte
+		if !p.CRCControl {
+			p.TransferComplete = true
+			data = p.WriteData
+			if irq {
+				p.DiskIRQ = true
+			}
+		}
+		if !p.DiskReady {
+			data = 0
+		}
+		if !p.CRCControl {
+			p.CRC = updateCRC(p.CRC, data)
+		} else {
+			if !p.PreviousCRCControl {
+				p.CRC = updateCRC(updateCRC(p.CRC, 0), 0)
+			}
+			data = byte(p.CRC)
+			p.CRC >>= 8
+		}
+		disk[p.Position] = data
+		p.modified = true
+		p.GapEnded = false
+	}
+	p.PreviousCRCControl = p.CRCControl
+	p.Position++
+	if int(p.Position) >= len(disk) {
+		p.MotorOn = false
+	} else {
+		p.Delay = BYTE_CYCLES
+	}
+}
+
+func (p *RAMAdapter) InsertOrEject() {
+	if p.Side >= 0 {
+		p.Side = -1
+	} else {
+		p.Side = p.SelectedSide
+	}
+}
+
+func (p *RAMAdapter) SelectNextSide() {
+	if p.Side < 0 {
+		p.SelectedSide = (p.SelectedSide + 1) % int32(len(p.sides))
+	}
+}
+
+// InsertedSide returns the side in the drive, -1 if there is none.
+func (p *RAMAdapter) InsertedSide() int {
+	return int(p.Side)
+}
+
+func (p *RAMAdapter) DiskModified() bool {
+	return p.modified
+}
+
+// SaveDisk writes the disk in the .fds format.
+func (p *RAMAdapter) SaveDisk(w io.Writer) error {
+	if err := p.Image().Write(w); err != nil {
+		return err
+	}
+	p.modified = false
+	return nil
+}
+
+// LoadDisk replaces the disk with an image of the same disk, like one written by SaveDisk.
+func (p *RAMAdapter) LoadDisk(r io.Reader) error {
+	image, err := NewImage(r)
+	if err != nil {
+		return err
+	}
+	if len(image.Sides) != len(p.sides) {
+		return fmt.Errorf("disk has %d sides, %d expected", len(image.Sides), len(p.sides))
+	}
+	p.setSides(image)
+	p.modified = false
+	return nil
+}
+
+// Image returns the disk in the drive.
+func (p *RAMAdapter) Image() *Image {
+	image := &Image{}
+	for _, side := range p.sides {
+		image.Sides = append(image.Sides, fromRaw(side))
+	}
+	return image
+}
@@ -0,0 +1,174 @@
+package fds
+
+import (
+	"bytes"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"testing"
+)
+
+// newSide makes a side with a file of the given contents.
+func newSide(contents []byte) []byte {
+	side := []byte(DISK_INFO_MAGIC)
+	side = append(side, make([]byte, 56-len(side))...)
+	side = append(side, BLOCK_FILE_AMOUNT, 1)
+	header := make([]byte, 16)
+	header[0] = BLOCK_FILE_HEADER
+	header[13], header[14] = byte(len(contents)), byte(len(contents)>>8)
+	side = append(side, header...)
+	side = append(side, BLOCK_FILE_DATA)
+	side = append(side, contents...)
+	return append(side, make([]byte, SIDE_SIZE-len(side))...)
+}
+
+func TestNewImage(t *testing.T) {
+	sides := [][]byte{newSide([]byte("side A")), newSide([]byte("side B"))}
+	image := &Image{Sides: sides}
+	fds := image.Bytes()
+
+	qd := []byte{}
+	for _, side := range sides {
+		qdSide := []byte{}
+		walkBlocks(side, false, func(block []byte) {
+			qdSide = append(qdSide, block...)
+			qdSide = append(qdSide, 0, 0)
+		})
+		qd = append(qd, append(qdSide, make([]byte, QD_SIDE_SIZE-len(qdSide))...)...)
+	}
+
+	for name, data := range map[string][]byte{"fds": fds, "headerless fds": fds[FDS_HEADER_SIZE:], "qd": qd} {
+		parsed, err := NewImage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(parsed.Sides) != 2 || !bytes.Equal(parsed.Sides[0], sides[0]) || !bytes.Equal(parsed.Sides[1], sides[1]) {
+			t.Errorf("%s: sides differ", name)
+		}
+	}
+	if _, err := NewImage(bytes.NewReader(fds[:len(fds)-1])); err == nil {
+		t.Errorf("truncated image accepted")
+	}
+	if raw := toRaw(sides[1]); !bytes.Equal(fromRaw(raw), sides[1]) {
+		t.Errorf("side changed by its layout on disk")
+	}
+}
+
+func newTestAdapter(t *testing.T) *RAMAdapter {
+	image := &Image{Sides: [][]byte{newSide([]byte("side A")), newSide([]byte("side B"))}}
+	rom, err := image.Cartridge(make([]byte, BIOS_SIZE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constructor := mappers.MapperConstructors[rom.Mapper]
+	if constructor == nil {
+		t.Fatalf("FDS mapper is not registered")
+	}
+	return constructor(rom).(*RAMAdapter)
+}
+
+// readBlock reads the next block from the disk the way the BIOS does, at every IRQ.
+func readBlock(p *RAMAdapter, length int) []byte {
+	p.PokePrg(0x4025, 0x2d) // motor on, read mode, horizontal
+	// skip the CRC of the previous block, into the gap
+	p.ClockCpu(4 * BYTE_CYCLES)
+	p.PokePrg(0x4025, 0xed) // IRQ on transfer after the end of the gap
+	var block []byte
+	for cycles := 0; len(block) < length && cycles < 1e7; cycles++ {
+		p.ClockCpu(1)
+		if p.IRQ() {
+			block = append(block, p.PeekPrg(0x4031))
+		}
+	}
+	return block
+}
+
+func TestDriveRead(t *testing.T) {
+	p := newTestAdapter(t)
+	p.PokePrg(0x4023, 0x01)
+	if block := readBlock(p, 15); string(block) != DISK_INFO_MAGIC {
+		t.Errorf("unexpected disk info block %q", block)
+	}
+	if p.PeekPrg(0x4032)&0x01 != 0 {
+		t.Errorf("disk not inserted")
+	}
+
+	p.InsertOrEject()
+	if p.PeekPrg(0x4032)&0x01 == 0 {
+		t.Errorf("disk not ejected")
+	}
+	p.SelectNextSide()
+	p.InsertOrEject()
+	p.PokePrg(0x4025, 0x2c) // motor off, the head goes back to the start
+	p.ClockCpu(1)
+	readBlock(p, 56)
+	readBlock(p, 2)
+	readBlock(p, 16)
+	if block := readBlock(p, 7); string(block) != "\x04side B" {
+		t.Errorf("unexpected file data block %q", block)
+	}
+}
+
+func TestDriveWrite(t *testing.T) {
+	p := newTestAdapter(t)
+	p.PokePrg(0x4023, 0x01)
+	readBlock(p, 56)
+	// write a file amount block, as the BIOS does after a gap
+	p.PokePrg(0x4025, 0x29) // motor on, write mode
+	data := []byte{0, 0, 0, GAP_TERMINATOR, BLOCK_FILE_AMOUNT, 0}
+	for i := 0; i < len(data); {
+		if i == 3 {
+			p.PokePrg(0x4025, 0x69)
+		}
+		p.PokePrg(0x4024, data[i])
+		for p.PeekPrg(0x4030)&0x02 == 0 {
+			p.ClockCpu(1)
+		}
+		i++
+	}
+	p.PokePrg(0x4025, 0x79) // CRC
+	p.ClockCpu(3 * BYTE_CYCLES)
+	p.PokePrg(0x4025, 0x2c)
+	if !p.DiskModified() {
+		t.Fatalf("disk not modified")
+	}
+	saved := &bytes.Buffer{}
+	if err := p.SaveDisk(saved); err != nil {
+		t.Fatal(err)
+	}
+	image, err := NewImage(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Sides[0][56] != BLOCK_FILE_AMOUNT || image.Sides[0][57] != 0 {
+		t.Errorf("unexpected file amount block % x", image.Sides[0][56:58])
+	}
+	if !bytes.Equal(image.Sides[1], newSide([]byte("side B"))) {
+		t.Errorf("other side changed")
+	}
+}
+
+func TestTimerIRQ(t *testing.T) {
+	p := newTestAdapter(t)
+	p.PokePrg(0x4020, 10)
+	p.PokePrg(0x4021, 0)
+	p.PokePrg(0x4022, 0x02)
+	if p.TimerEnabled {
+		t.Errorf("timer enabled while disk I/O is disabled")
+	}
+	p.PokePrg(0x4023, 0x01)
+	p.PokePrg(0x4022, 0x03)
+	p.ClockCpu(10)
+	if p.IRQ() {
+		t.Errorf("IRQ raised early")
+	}
+	p.ClockCpu(1)
+	if !p.IRQ() {
+		t.Errorf("IRQ not raised")
+	}
+	if p.PeekPrg(0x4030)&0x01 == 0 || p.IRQ() {
+		t.Errorf("IRQ not acknowledged by reading $4030")
+	}
+	p.ClockCpu(11)
+	if !p.IRQ() {
+		t.Errorf("repeating IRQ not raised")
+	}
+}
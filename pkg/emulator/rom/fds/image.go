@@ -0,0 +1,144 @@
+/*
+Famicom Disk System images, http://wiki.nesdev.com/w/index.php/FDS_file_format
+
+Byte     Contents
+---------------------------------------------------------------------------
+0-3      String "FDS^Z", the header is optional.
+4        Number of disk sides.
+5-15     Reserved, must be zeroes.
+16-...   Disk sides of 65500 bytes, holding the blocks of the disk without gaps and CRCs:
+         1 disk info (56 bytes), 2 file amount (2 bytes),
+         then for every file 3 file header (16 bytes, file size at 13-14) and 4 file data (1 + file size).
+---------------------------------------------------------------------------
+.qd images of the Quick Disk format have sides of 65536 bytes, with the 2-byte CRC of every block after it.
+*/
+
+package fds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	FDS_FILE_MAGIC  = "FDS\x1a"
+	FDS_HEADER_SIZE = 16
+	SIDE_SIZE       = 65500
+	QD_SIDE_SIZE    = 65536
+	// the disk info block starts every side
+	DISK_INFO_MAGIC = "\x01*NINTENDO-HVC*"
+)
+
+const (
+	BLOCK_DISK_INFO   = 1
+	BLOCK_FILE_AMOUNT = 2
+	BLOCK_FILE_HEADER = 3
+	BLOCK_FILE_DATA   = 4
+)
+
+// Image is a disk in memory.
+type Image struct {
+	// disk sides in the .fds layout, SIDE_SIZE bytes each
+	Sides [][]byte
+}
+
+// NewImage reads a .fds image, with or without header, or a .qd image.
+func NewImage(reader io.Reader) (*Image, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(FDS_FILE_MAGIC)) {
+		if len(data) < FDS_HEADER_SIZE {
+			return nil, fmt.Errorf("FDS header is truncated")
+		}
+		data = data[FDS_HEADER_SIZE:]
+	}
+	if !bytes.HasPrefix(data, []byte(DISK_INFO_MAGIC)) {
+		return nil, fmt.Errorf("no FDS disk info block is found")
+	}
+	image := &Image{}
+	switch {
+	case len(data)%SIDE_SIZE == 0:
+		for i := 0; i < len(data); i += SIDE_SIZE {
+			image.Sides = append(image.Sides, append([]byte{}, data[i:i+SIDE_SIZE]...))
+		}
+	case len(data)%QD_SIDE_SIZE == 0:
+		for i := 0; i < len(data); i += QD_SIDE_SIZE {
+			side := make([]byte, 0, SIDE_SIZE)
+			walkBlocks(data[i:i+QD_SIDE_SIZE], true, func(block []byte) {
+				side = append(side, block...)
+			})
+			image.Sides = append(image.Sides, append(side, make([]byte, SIDE_SIZE-len(side))...))
+		}
+	default:
+		return nil, fmt.Errorf("FDS image of %d bytes is neither made of %d nor %d byte sides", len(data), SIDE_SIZE, QD_SIDE_SIZE)
+	}
+	return image, nil
+}
+
+// Write writes the image in the .fds format, with header.
+func (p *Image) Write(w io.Writer) error {
+	header := make([]byte, FDS_HEADER_SIZE)
+	copy(header, FDS_FILE_MAGIC)
+	header[4] = byte(len(p.Sides))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, side := range p.Sides {
+		if _, err := w.Write(side); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes returns the image in the .fds format.
+func (p *Image) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	p.Write(buf)
+	return buf.Bytes()
+}
+
+// walkBlocks calls fn with every block of a side, which may be followed by their CRC.
+func walkBlocks(side []byte, withCRC bool, fn func(block []byte)) {
+	fileSize := 0
+	for pos := 0; pos < len(side); {
+		length := blockLength(side[pos:], &fileSize)
+		if length == 0 {
+			return
+		}
+		fn(side[pos : pos+length])
+		pos += length
+		if withCRC {
+			pos += 2
+		}
+	}
+}
+
+// blockLength returns the length of the block starting data, 0 if there is no complete block.
+// fileSize is the size given by the last file header, which is updated by file headers.
+func blockLength(data []byte, fileSize *int) int {
+	length := 0
+	switch data[0] {
+	case BLOCK_DISK_INFO:
+		length = 56
+	case BLOCK_FILE_AMOUNT:
+		length = 2
+	case BLOCK_FILE_HEADER:
+		length = 16
+		if length <= len(data) {
+			*fileSize = int(data[13]) | int(data[14])<<8
+		}
+	case BLOCK_FILE_DATA:
+		length = 1 + *fileSize
+	default:
+		return 0
+	}
+	if length > len(data) {
+		return 0
+	}
+	return length
+}
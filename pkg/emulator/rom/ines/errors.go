@@ -0,0 +1,51 @@
+package ines
+
+import "fmt"
+
+type FormatErrorKind int
+
+const (
+	// the file ends before the sizes given in the header
+	ERROR_TRUNCATED FormatErrorKind = iota
+	// the file doesn't start with INES_FILE_MAGIC
+	ERROR_BAD_MAGIC
+	// the header gives no PRG ROM
+	ERROR_ZERO_PRG
+	// the header gives sizes larger than MAX_ROM_SIZE
+	ERROR_OVERSIZE
+)
+
+func (k FormatErrorKind) String() string {
+	switch k {
+	case ERROR_TRUNCATED:
+		return "truncated"
+	case ERROR_BAD_MAGIC:
+		return "bad magic"
+	case ERROR_ZERO_PRG:
+		return "zero PRG"
+	case ERROR_OVERSIZE:
+		return "oversize"
+	default:
+		return fmt.Sprintf("FormatErrorKind(%d)", int(k))
+	}
+}
+
+// FormatError is returned for files which are not valid iNES ROMs.
+type FormatError struct {
+	Kind    FormatErrorKind
+	Message string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("invalid iNES ROM (%v): %s", e.Kind, e.Message)
+}
+
+func formatError(kind FormatErrorKind, format string, args ...interface{}) error {
+	return &FormatError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsFormatError tells whether err is a FormatError of the kind.
+func IsFormatError(err error, kind FormatErrorKind) bool {
+	formatErr, ok := err.(*FormatError)
+	return ok && formatErr.Kind == kind
+}
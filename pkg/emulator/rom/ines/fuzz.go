@@ -0,0 +1,24 @@
+//go:build gofuzz
+// +build gofuzz
+
+package ines
+
+import "bytes"
+
+// Fuzz is the entry point for go-fuzz:
+//
+//	go-fuzz-build github.com/vfreex/gones/pkg/emulator/rom/ines && go-fuzz
+func Fuzz(data []byte) int {
+	rom, err := NewINesRomWithOptions(bytes.NewReader(data), &LoadOptions{})
+	if err != nil {
+		if _, ok := err.(*FormatError); !ok {
+			panic(err)
+		}
+		return 0
+	}
+	if len(rom.PrgBin) != rom.Header.PrgRomBytes() || len(rom.ChrBin) != rom.Header.ChrRomBytes() {
+		panic("ROM sizes differ from the header")
+	}
+	_ = rom.String()
+	return 1
+}
@@ -18,6 +18,7 @@ byte is zero.
 9        bit 0     1 for PAL cartridges, otherwise assume NTSC.
 bit 1-7   Reserved, must be zeroes!
 10-15    Reserved, must be zeroes!
+         (NES 2.0 headers use bytes 7-15 differently, see nes20.go)
 16-...   ROM banks, in ascending order. If a trainer is present, its
 512 bytes precede the ROM bank contents.
 ...-EOF  VROM banks, in ascending order.
@@ -31,7 +32,11 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/logger"
 	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/romdb"
 	"io"
 )
 
@@ -41,6 +46,7 @@ const (
 	CHR_BANK_SIZE     = 8 * 1024  // bytes in a CHR/VROM bank
 	PRG_RAM_BANK_SIZE = 8 * 1024  // bytes in a RPG RAM bank
 	TRAINER_SIZE      = 512       // optional trainer size in bytes
+	MAX_ROM_SIZE      = 64 << 20  // PRG or CHR ROM sizes beyond are rejected as corrupted headers
 )
 
 const (
@@ -50,12 +56,16 @@ const (
 	FLAGS6_FOUR_SCREEN_VRAM_ON = 1 << 3
 
 	FLAGS7_VS_SYSTEM_ON = 1
+	FLAGS7_NES20_MASK   = 0x0c
+	FLAGS7_NES20        = 0x08
 
 	FLAGS9_PAL_ON = 1
 )
 
 const (
 	MAPPER_NORM = 0
+	// the RAM adapter of the Famicom Disk System, with the BIOS as PRG ROM and the disk image as extra data
+	MAPPER_FDS = 20
 )
 
 type INesHeader struct {
@@ -66,7 +76,13 @@ type INesHeader struct {
 	Flags7     byte
 	PrgRamSize byte // in 8kB units, value 0 means 1x8kB for compatibility, see http://wiki.nesdev.com/w/index.php/PRG_RAM_circuit
 	Flags9     byte
-	_          [6]byte
+	// only used by NES 2.0
+	Flags10 byte
+	Flags11 byte
+	Flags12 byte
+	Flags13 byte
+	Flags14 byte
+	Flags15 byte
 }
 
 type INesRom struct {
@@ -77,37 +93,58 @@ type INesRom struct {
 	PrgBin  []byte
 	ChrBin  []byte
 	Extra   []byte
+	// header fields corrected from the ROM database
+	Corrections []string
 	//Mapper  mappers.Mapper
 }
 
 func NewINesRom(reader io.Reader) (*INesRom, error) {
+	return NewINesRomWithOptions(reader, &LoadOptions{})
+}
+
+func NewINesRomWithOptions(reader io.Reader, options *LoadOptions) (*INesRom, error) {
 	rom := &INesRom{}
 	header := &rom.Header
 	if err := binary.Read(reader, binary.LittleEndian, header); err != nil {
-		return rom, err
+		return rom, truncatedError(err, "header")
 	}
 	if string(header.Magic[:]) != INES_FILE_MAGIC {
-		return rom, fmt.Errorf("no valid header is found")
+		return rom, formatError(ERROR_BAD_MAGIC, "file starts with %q", header.Magic[:])
+	}
+	if header.isDirty() {
+		// bytes 7-15 were used for ripper signatures like "DiskDude!" before NES 2.0
+		correction := fmt.Sprintf("ignored dirty header bytes 7-15: %q", header.dirtyBytes())
+		logger.GetLogger().Infof("%s", correction)
+		rom.Corrections = append(rom.Corrections, correction)
+		header.clean()
+	}
+
+	prgBytes, chrBytes := header.PrgRomBytes(), header.ChrRomBytes()
+	if prgBytes == 0 {
+		return rom, formatError(ERROR_ZERO_PRG, "header gives no PRG ROM")
+	}
+	if prgBytes > MAX_ROM_SIZE || chrBytes > MAX_ROM_SIZE {
+		return rom, formatError(ERROR_OVERSIZE, "PRG ROM of %d bytes and CHR ROM of %d bytes exceed %d bytes", prgBytes, chrBytes, MAX_ROM_SIZE)
 	}
 
 	if header.Flags6&FLAGS6_TRAINER_ON != 0 {
 		rom.Trainer = make([]byte, TRAINER_SIZE)
-		if _, err := reader.Read(rom.Trainer); err != nil {
-			return rom, err
+		if _, err := io.ReadFull(reader, rom.Trainer); err != nil {
+			return rom, truncatedError(err, "trainer")
 		}
 	}
 
-	prgBin := make([]byte, PRG_BANK_SIZE*int(header.PrgSize))
-	if _, err := reader.Read(prgBin); err != nil {
-		return rom, err
+	prgBin := make([]byte, prgBytes)
+	if _, err := io.ReadFull(reader, prgBin); err != nil {
+		return rom, truncatedError(err, "PRG ROM")
 	}
 
 	var chrBin []byte
 
-	if header.ChrSize > 0 {
-		chrBin = make([]byte, CHR_BANK_SIZE*int(header.ChrSize))
-		if _, err := reader.Read(chrBin); err != nil {
-			return rom, err
+	if chrBytes > 0 {
+		chrBin = make([]byte, chrBytes)
+		if _, err := io.ReadFull(reader, chrBin); err != nil {
+			return rom, truncatedError(err, "CHR ROM")
 		}
 	}
 
@@ -135,34 +172,173 @@ func NewINesRom(reader io.Reader) (*INesRom, error) {
 	}
 	rom.Extra = extra.Bytes()
 
+	if !options.NoDatabase {
+		db := options.Database
+		if db == nil {
+			db = romdb.Default
+		}
+		rom.applyDatabase(db)
+	}
 	return rom, nil
 }
 func (p *INesRom) String() string {
-	return fmt.Sprintf("iNESRom{header: %v, trainer: %d, PRG: %d, CHR: %d, EXTRA: %d}", &p.Header, len(p.Trainer), p.Header.PrgSize, p.Header.ChrSize, len(p.Extra))
+	return fmt.Sprintf("iNESRom{header: %v, trainer: %d, PRG: %d, CHR: %d, EXTRA: %d}", &p.Header, len(p.Trainer), len(p.PrgBin), len(p.ChrBin), len(p.Extra))
+}
+
+// Cartridge describes the cartridge given by the header and the ROMs.
+func (p *INesRom) Cartridge() *cartridge.Cartridge {
+	h := &p.Header
+	format := "iNES"
+	if h.IsNES20() {
+		format = "NES 2.0"
+	}
+	return &cartridge.Cartridge{
+		Format:       format,
+		Mapper:       h.GetMapperType(),
+		Submapper:    h.Submapper(),
+		PrgBin:       p.PrgBin,
+		ChrBin:       p.ChrBin,
+		Trainer:      p.Trainer,
+		PrgRamSize:   h.PrgRamBytes(),
+		PrgNvramSize: h.PrgNvramBytes(),
+		ChrRamSize:   h.ChrRamBytes(),
+		ChrNvramSize: h.ChrNvramBytes(),
+		Battery:      h.Flags6&FLAGS6_BATTERY_RAM_ON != 0,
+		Mirroring:    h.mirroring(),
+		Region:       h.Region(),
+		Extra:        p.Extra,
+		Corrections:  p.Corrections,
+	}
 }
+
 func (p *INesRom) MatchesFileMagic(reader io.Reader) (bool, error) {
 	magic := make([]byte, 4)
-	if n, err := reader.Read(magic); n != 4 || string(magic) != INES_FILE_MAGIC {
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != INES_FILE_MAGIC {
 		return false, err
 	}
 	return true, nil
 }
 
+// truncatedError turns the end of the file while reading a part of the ROM into an ERROR_TRUNCATED FormatError.
+func truncatedError(err error, part string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return formatError(ERROR_TRUNCATED, "file ends in the %s", part)
+	}
+	return err
+}
+
+// isDirty tells whether an iNES header has garbage in bytes 7-15,
+// in which case only bytes 4-6 can be trusted, see http://wiki.nesdev.com/w/index.php/INES#Variant_comparison
+func (h *INesHeader) isDirty() bool {
+	if h.IsNES20() {
+		return false
+	}
+	return h.Flags7&FLAGS7_NES20_MASK != 0 || h.Flags12 != 0 || h.Flags13 != 0 || h.Flags14 != 0 || h.Flags15 != 0
+}
+
+func (h *INesHeader) dirtyBytes() []byte {
+	return []byte{h.Flags7, h.PrgRamSize, h.Flags9, h.Flags10, h.Flags11, h.Flags12, h.Flags13, h.Flags14, h.Flags15}
+}
+
+func (h *INesHeader) clean() {
+	h.Flags7, h.PrgRamSize, h.Flags9, h.Flags10, h.Flags11 = 0, 0, 0, 0, 0
+	h.Flags12, h.Flags13, h.Flags14, h.Flags15 = 0, 0, 0, 0
+}
+
 func (h *INesHeader) String() string {
 	m := map[string]interface{}{
-		"type":          "iNES",
-		"mapper_type":   h.GetMapperType(),
-		"prg_bytes":     int(h.PrgSize) * PRG_BANK_SIZE,
-		"chr_bytes":     int(h.ChrSize) * CHR_BANK_SIZE,
-		"trainer":       h.Flags6&FLAGS6_TRAINER_ON != 0,
-		"prg_ram_bytes": PRG_RAM_BANK_SIZE,
+		"type":            "iNES",
+		"mapper_type":     h.GetMapperType(),
+		"prg_bytes":       h.PrgRomBytes(),
+		"chr_bytes":       h.ChrRomBytes(),
+		"trainer":         h.Flags6&FLAGS6_TRAINER_ON != 0,
+		"prg_ram_bytes":   h.PrgRamBytes(),
+		"prg_nvram_bytes": h.PrgNvramBytes(),
+		"chr_ram_bytes":   h.ChrRamBytes(),
+		"region":          h.Region().String(),
 	}
-	if h.PrgRamSize > 0 {
-		m["prg_ram_bytes"] = PRG_RAM_BANK_SIZE * int(h.PrgRamSize)
+	if h.IsNES20() {
+		m["type"] = "NES 2.0"
+		m["submapper"] = h.Submapper()
+		m["chr_nvram_bytes"] = h.ChrNvramBytes()
+		m["console_type"] = h.ConsoleType()
+		m["expansion_device"] = h.ExpansionDevice()
 	}
 	r, _ := json.Marshal(m)
 	return string(r)
 }
 func (h *INesHeader) GetMapperType() int {
-	return int((h.Flags7 & 0xF0) | (h.Flags6 >> 4))
+	mapper := int((h.Flags7 & 0xF0) | (h.Flags6 >> 4))
+	if h.IsNES20() {
+		mapper |= int(h.PrgRamSize&0x0f) << 8
+	}
+	return mapper
+}
+
+// Region returns the console the cartridge is made for.
+func (h *INesHeader) Region() region.Region {
+	if h.IsNES20() {
+		return h.nes20Region()
+	}
+	if h.Flags9&FLAGS9_PAL_ON != 0 {
+		return region.REGION_PAL
+	}
+	return region.REGION_NTSC
+}
+
+// PrgRomBytes returns the size of the PRG ROM.
+func (h *INesHeader) PrgRomBytes() int {
+	if h.IsNES20() {
+		return nes20RomSize(h.PrgSize, h.Flags9&0x0f, PRG_BANK_SIZE)
+	}
+	return int(h.PrgSize) * PRG_BANK_SIZE
+}
+
+// ChrRomBytes returns the size of the CHR ROM, 0 when the board uses CHR RAM.
+func (h *INesHeader) ChrRomBytes() int {
+	if h.IsNES20() {
+		return nes20RomSize(h.ChrSize, h.Flags9>>4, CHR_BANK_SIZE)
+	}
+	return int(h.ChrSize) * CHR_BANK_SIZE
+}
+
+// PrgRamBytes returns the size of the volatile PRG RAM.
+// iNES headers can't tell it apart from battery-backed PRG RAM, which is assumed if the battery flag is set.
+func (h *INesHeader) PrgRamBytes() int {
+	if h.IsNES20() {
+		return nes20RamSize(h.Flags10 & 0x0f)
+	}
+	if h.Flags6&FLAGS6_BATTERY_RAM_ON != 0 {
+		return 0
+	}
+	return h.inesPrgRamBytes()
+}
+
+// PrgNvramBytes returns the size of the battery-backed PRG RAM.
+func (h *INesHeader) PrgNvramBytes() int {
+	if h.IsNES20() {
+		return nes20RamSize(h.Flags10 >> 4)
+	}
+	if h.Flags6&FLAGS6_BATTERY_RAM_ON == 0 {
+		return 0
+	}
+	return h.inesPrgRamBytes()
+}
+
+func (h *INesHeader) inesPrgRamBytes() int {
+	if h.PrgRamSize == 0 {
+		return PRG_RAM_BANK_SIZE
+	}
+	return int(h.PrgRamSize) * PRG_RAM_BANK_SIZE
+}
+
+// ChrRamBytes returns the size of the volatile CHR RAM, 8 KB for iNES boards without CHR ROM.
+func (h *INesHeader) ChrRamBytes() int {
+	if h.IsNES20() {
+		return nes20RamSize(h.Flags11 & 0x0f)
+	}
+	if h.ChrSize == 0 {
+		return CHR_BANK_SIZE
+	}
+	return 0
 }
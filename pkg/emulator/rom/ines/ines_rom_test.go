@@ -0,0 +1,205 @@
+package ines
+
+import (
+	"bytes"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/romdb"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestINesHeader(t *testing.T) {
+	rom := []byte("NES\x1a\x02\x01\x12\x10\x00\x00\x00\x00\x00\x00\x00\x00")
+	rom = append(rom, make([]byte, 2*PRG_BANK_SIZE+CHR_BANK_SIZE)...)
+	parsed, err := NewINesRom(bytes.NewReader(rom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &parsed.Header
+	if h.IsNES20() {
+		t.Errorf("iNES header detected as NES 2.0")
+	}
+	if h.GetMapperType() != 0x11 || h.PrgRomBytes() != 2*PRG_BANK_SIZE || h.ChrRomBytes() != CHR_BANK_SIZE {
+		t.Errorf("unexpected header %v", h)
+	}
+	if h.PrgRamBytes() != 0 || h.PrgNvramBytes() != PRG_RAM_BANK_SIZE {
+		t.Errorf("battery-backed PRG RAM expected, got %v", h)
+	}
+	cart := parsed.Cartridge()
+	if cart.Format != "iNES" || cart.Mapper != 0x11 || len(cart.PrgBin) != 2*PRG_BANK_SIZE || len(cart.ChrBin) != CHR_BANK_SIZE ||
+		!cart.Battery || cart.PrgNvramSize != PRG_RAM_BANK_SIZE || cart.ChrRamSize != 0 ||
+		cart.Mirroring != cartridge.MIRRORING_HORIZONTAL || cart.Region != region.REGION_NTSC {
+		t.Errorf("unexpected cartridge %v", cart)
+	}
+}
+
+func TestNES20Header(t *testing.T) {
+	h := &INesHeader{
+		PrgSize:    0x02,
+		ChrSize:    0x00,
+		Flags6:     0x40,
+		Flags7:     0x19, // Vs. System, NES 2.0
+		PrgRamSize: 0x31, // submapper 3, mapper bits 8-11 = 1
+		Flags9:     0x10, // CHR ROM size MSB
+		Flags10:    0x70, // 8 KB PRG NVRAM
+		Flags11:    0x07, // 8 KB CHR RAM
+		Flags12:    0x03, // Dendy
+		Flags13:    0x21, // Vs. hardware 2, PPU 1
+		Flags15:    EXPANSION_ZAPPER,
+	}
+	if !h.IsNES20() {
+		t.Fatalf("NES 2.0 header not detected")
+	}
+	expected := []struct {
+		name           string
+		actual, wanted interface{}
+	}{
+		{"mapper", h.GetMapperType(), 0x114},
+		{"submapper", h.Submapper(), 3},
+		{"PRG ROM", h.PrgRomBytes(), 2 * PRG_BANK_SIZE},
+		{"CHR ROM", h.ChrRomBytes(), 0x100 * CHR_BANK_SIZE},
+		{"PRG RAM", h.PrgRamBytes(), 0},
+		{"PRG NVRAM", h.PrgNvramBytes(), 8192},
+		{"CHR RAM", h.ChrRamBytes(), 8192},
+		{"CHR NVRAM", h.ChrNvramBytes(), 0},
+		{"region", h.Region(), region.REGION_DENDY},
+		{"console", h.ConsoleType(), CONSOLE_VS_SYSTEM},
+		{"Vs. PPU", h.VsPPUType(), 1},
+		{"Vs. hardware", h.VsHardwareType(), 2},
+		{"expansion device", h.ExpansionDevice(), EXPANSION_ZAPPER},
+	}
+	for _, e := range expected {
+		if e.actual != e.wanted {
+			t.Errorf("%s: expected %v, got %v", e.name, e.wanted, e.actual)
+		}
+	}
+
+	// exponent-multiplier notation: 2^10 * 3
+	h.Flags9 = 0x0f
+	h.PrgSize = 10<<2 | 1
+	if size := h.PrgRomBytes(); size != 3072 {
+		t.Errorf("expected 3072 bytes of PRG ROM, got %d", size)
+	}
+}
+
+func TestDatabaseCorrection(t *testing.T) {
+	// mapper 4 and horizontal mirroring in the header, garbage in bytes 7-15
+	rom := []byte("NES\x1a\x02\x01\x40DiskDude!")
+	prg := make([]byte, 2*PRG_BANK_SIZE)
+	chr := make([]byte, CHR_BANK_SIZE)
+	prg[0], chr[0] = 1, 2
+	rom = append(append(rom, prg...), chr...)
+	db := romdb.NewDatabase([]romdb.Entry{{
+		Name:      "Test Game",
+		CRC32:     crc32.ChecksumIEEE(append(append([]byte{}, prg...), chr...)),
+		Mapper:    0,
+		Mirroring: romdb.MIRRORING_VERTICAL,
+		Region:    region.REGION_PAL,
+	}})
+
+	parsed, err := NewINesRomWithOptions(bytes.NewReader(rom), &LoadOptions{Database: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &parsed.Header
+	if !h.IsNES20() || h.GetMapperType() != 0 || h.Flags6&FLAGS6_VERTICAL_MIRRORING == 0 || h.Region() != region.REGION_PAL {
+		t.Errorf("header not corrected: %v", h)
+	}
+	if h.PrgRomBytes() != len(prg) || h.ChrRomBytes() != len(chr) || h.PrgRamBytes() != PRG_RAM_BANK_SIZE || h.ExpansionDevice() != 0 {
+		t.Errorf("unexpected corrected header: %v", h)
+	}
+	if len(parsed.Corrections) < 2 {
+		t.Errorf("corrections not reported: %v", parsed.Corrections)
+	}
+
+	parsed, err = NewINesRomWithOptions(bytes.NewReader(rom), &LoadOptions{Database: db, NoDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.IsNES20() || parsed.Header.GetMapperType() != 4 || len(parsed.Corrections) != 1 {
+		t.Errorf("header corrected with the database disabled: %v", &parsed.Header)
+	}
+}
+
+func TestDatabaseMatch(t *testing.T) {
+	// a clean iNES header agreeing with the entry, which leaves the RAM sizes out
+	rom := []byte("NES\x1a\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	prg := make([]byte, 2*PRG_BANK_SIZE)
+	chr := make([]byte, CHR_BANK_SIZE)
+	prg[0], chr[0] = 1, 2
+	rom = append(append(rom, prg...), chr...)
+	db := romdb.NewDatabase([]romdb.Entry{{
+		Name:      "Test Game",
+		CRC32:     crc32.ChecksumIEEE(append(append([]byte{}, prg...), chr...)),
+		Mirroring: romdb.MIRRORING_VERTICAL,
+		Region:    region.REGION_NTSC,
+	}})
+
+	parsed, err := NewINesRomWithOptions(bytes.NewReader(rom), &LoadOptions{Database: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Corrections) != 0 {
+		t.Errorf("header matching the database corrected: %v", parsed.Corrections)
+	}
+	if h := &parsed.Header; h.IsNES20() || h.PrgRamBytes() != PRG_RAM_BANK_SIZE {
+		t.Errorf("unexpected header: %v", h)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	valid := append([]byte("NES\x1a\x01\x01\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+		make([]byte, TRAINER_SIZE+PRG_BANK_SIZE+CHR_BANK_SIZE)...)
+	oversize := append([]byte{}, valid...)
+	oversize[7], oversize[9] = FLAGS7_NES20, 0x0f
+	oversize[4] = 0xff
+	cases := []struct {
+		name string
+		rom  []byte
+		kind FormatErrorKind
+	}{
+		{"empty", nil, ERROR_TRUNCATED},
+		{"short header", valid[:10], ERROR_TRUNCATED},
+		{"short trainer", valid[:16+TRAINER_SIZE-1], ERROR_TRUNCATED},
+		{"short PRG", valid[:16+TRAINER_SIZE+PRG_BANK_SIZE-1], ERROR_TRUNCATED},
+		{"short CHR", valid[:len(valid)-1], ERROR_TRUNCATED},
+		{"bad magic", append([]byte("NES\x00"), valid[4:]...), ERROR_BAD_MAGIC},
+		{"zero PRG", append(append([]byte{}, valid[:4]...), append([]byte{0}, valid[5:]...)...), ERROR_ZERO_PRG},
+		{"oversize", oversize, ERROR_OVERSIZE},
+	}
+	for _, c := range cases {
+		_, err := NewINesRom(bytes.NewReader(c.rom))
+		if !IsFormatError(err, c.kind) {
+			t.Errorf("%s: %v error expected, got %v", c.name, c.kind, err)
+		}
+	}
+	if _, err := NewINesRom(iotest.OneByteReader(bytes.NewReader(valid))); err != nil {
+		t.Errorf("short reads not handled: %v", err)
+	}
+}
+
+// TestParserFuzz feeds the parser with random mutations of a valid ROM.
+// Run the Fuzz function with go-fuzz for a more thorough search.
+func TestParserFuzz(t *testing.T) {
+	valid := append([]byte("NES\x1a\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), make([]byte, PRG_BANK_SIZE+CHR_BANK_SIZE)...)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		rom := append([]byte{}, valid[:16+random.Intn(len(valid)-15)]...)
+		for j := random.Intn(8); j >= 0; j-- {
+			rom[4+random.Intn(12)] = byte(random.Intn(256))
+		}
+		parsed, err := NewINesRomWithOptions(bytes.NewReader(rom), &LoadOptions{NoDatabase: true})
+		if err != nil {
+			if _, ok := err.(*FormatError); !ok {
+				t.Fatalf("unexpected error type for header % x: %v", rom[:16], err)
+			}
+			continue
+		}
+		if len(parsed.PrgBin) != parsed.Header.PrgRomBytes() || len(parsed.ChrBin) != parsed.Header.ChrRomBytes() {
+			t.Fatalf("ROM sizes differ from header % x", rom[:16])
+		}
+	}
+}
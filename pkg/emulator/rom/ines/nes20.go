@@ -0,0 +1,154 @@
+/*
+NES 2.0 extends the iNES header, http://wiki.nesdev.com/w/index.php/NES_2.0
+
+Byte     Contents
+---------------------------------------------------------------------------
+7        bit 0-1   Console type: 0 NES/Famicom, 1 Vs. System, 2 PlayChoice-10, 3 extended.
+         bit 2-3   2 for NES 2.0.
+8        bit 0-3   Bits 8-11 of the mapper number.
+         bit 4-7   Submapper number.
+9        bit 0-3   PRG ROM size MSB.
+         bit 4-7   CHR ROM size MSB.
+10       bit 0-3   PRG RAM shift count, bit 4-7 PRG NVRAM shift count (64 << count bytes, 0 for none).
+11       bit 0-3   CHR RAM shift count, bit 4-7 CHR NVRAM shift count.
+12       bit 0-1   CPU/PPU timing: 0 NTSC, 1 PAL, 2 multiple regions, 3 Dendy.
+13       Vs. System: bit 0-3 PPU type, bit 4-7 hardware type.
+         Extended console: bit 0-3 extended console type.
+14       bit 0-1   Number of miscellaneous ROMs.
+15       bit 0-5   Default expansion device.
+---------------------------------------------------------------------------
+When the MSB of a ROM size is $F, the LSB is an exponent-multiplier: EEEEEEMM, for 2^E * (MM*2+1) bytes.
+*/
+
+package ines
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"math"
+)
+
+type ConsoleType int
+
+const (
+	CONSOLE_NES ConsoleType = iota
+	CONSOLE_VS_SYSTEM
+	CONSOLE_PLAYCHOICE_10
+	CONSOLE_EXTENDED
+)
+
+// some default expansion devices,
+// http://wiki.nesdev.com/w/index.php/NES_2.0#Default_Expansion_Device
+const (
+	EXPANSION_UNSPECIFIED         = 0x00
+	EXPANSION_STANDARD_CONTROLLER = 0x01
+	EXPANSION_FOUR_SCORE          = 0x02
+	EXPANSION_FAMICOM_4_PLAYERS   = 0x03
+	EXPANSION_VS_SYSTEM           = 0x04
+	EXPANSION_ZAPPER              = 0x08
+	EXPANSION_POWER_PAD           = 0x0b
+	EXPANSION_ARKANOID_NES        = 0x0f
+	EXPANSION_FAMILY_BASIC        = 0x23
+)
+
+// IsNES20 tells whether the header is in the NES 2.0 format.
+func (h *INesHeader) IsNES20() bool {
+	return h.Flags7&FLAGS7_NES20_MASK == FLAGS7_NES20
+}
+
+// Submapper returns the NES 2.0 submapper number, 0 for iNES.
+func (h *INesHeader) Submapper() int {
+	if !h.IsNES20() {
+		return 0
+	}
+	return int(h.PrgRamSize >> 4)
+}
+
+// ChrNvramBytes returns the size of the battery-backed CHR RAM, which only NES 2.0 headers specify.
+func (h *INesHeader) ChrNvramBytes() int {
+	if !h.IsNES20() {
+		return 0
+	}
+	return nes20RamSize(h.Flags11 >> 4)
+}
+
+func (h *INesHeader) ConsoleType() ConsoleType {
+	if !h.IsNES20() {
+		if h.Flags7&FLAGS7_VS_SYSTEM_ON != 0 {
+			return CONSOLE_VS_SYSTEM
+		}
+		return CONSOLE_NES
+	}
+	return ConsoleType(h.Flags7 & 0x03)
+}
+
+// VsPPUType returns the RGB PPU of a Vs. System cartridge.
+func (h *INesHeader) VsPPUType() int {
+	if h.ConsoleType() != CONSOLE_VS_SYSTEM || !h.IsNES20() {
+		return 0
+	}
+	return int(h.Flags13 & 0x0f)
+}
+
+// VsHardwareType returns the Vs. System hardware and protection type.
+func (h *INesHeader) VsHardwareType() int {
+	if h.ConsoleType() != CONSOLE_VS_SYSTEM || !h.IsNES20() {
+		return 0
+	}
+	return int(h.Flags13 >> 4)
+}
+
+// ExtendedConsoleType returns the console type when ConsoleType is CONSOLE_EXTENDED.
+func (h *INesHeader) ExtendedConsoleType() int {
+	if h.ConsoleType() != CONSOLE_EXTENDED {
+		return 0
+	}
+	return int(h.Flags13 & 0x0f)
+}
+
+// MiscRoms returns the number of miscellaneous ROMs following the CHR ROM.
+func (h *INesHeader) MiscRoms() int {
+	if !h.IsNES20() {
+		return 0
+	}
+	return int(h.Flags14 & 0x03)
+}
+
+// ExpansionDevice returns the device plugged into the expansion port by default, see EXPANSION_*.
+func (h *INesHeader) ExpansionDevice() int {
+	if !h.IsNES20() {
+		return EXPANSION_UNSPECIFIED
+	}
+	return int(h.Flags15 & 0x3f)
+}
+
+func (h *INesHeader) nes20Region() region.Region {
+	switch h.Flags12 & 0x03 {
+	case 1:
+		return region.REGION_PAL
+	case 3:
+		return region.REGION_DENDY
+	default:
+		// multiple-region cartridges run on NTSC as well
+		return region.REGION_NTSC
+	}
+}
+
+func nes20RomSize(lsb, msb byte, unit int) int {
+	if msb == 0x0f {
+		exponent := uint(lsb >> 2)
+		multiplier := int64(lsb&0x03)*2 + 1
+		if exponent > 31 {
+			// no such ROM, but don't overflow
+			return math.MaxInt32
+		}
+		return int((int64(1) << exponent) * multiplier)
+	}
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+func nes20RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << uint(shift)
+}
@@ -0,0 +1,120 @@
+package ines
+
+import (
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/logger"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/romdb"
+)
+
+// LoadOptions controls how a ROM is loaded.
+type LoadOptions struct {
+	// disables the header corrections from the ROM database
+	NoDatabase bool
+	// database to look the ROM up in, romdb.Default if nil
+	Database *romdb.Database
+}
+
+func (h *INesHeader) mirroring() cartridge.Mirroring {
+	if h.Flags6&FLAGS6_FOUR_SCREEN_VRAM_ON != 0 {
+		return cartridge.MIRRORING_FOUR_SCREEN
+	}
+	if h.Flags6&FLAGS6_VERTICAL_MIRRORING != 0 {
+		return cartridge.MIRRORING_VERTICAL
+	}
+	return cartridge.MIRRORING_HORIZONTAL
+}
+
+// applyDatabase corrects the header with the database entry of the ROM, if any.
+// A corrected header is rewritten in the NES 2.0 format, and the corrections are kept in rom.Corrections.
+func (p *INesRom) applyDatabase(db *romdb.Database) {
+	entry := db.Lookup(p.PrgBin, p.ChrBin)
+	if entry == nil {
+		return
+	}
+	old := p.Header
+	h := old
+	h.Flags6 = old.Flags6&FLAGS6_TRAINER_ON | byte(entry.Mapper&0x0f)<<4
+	switch entry.Mirroring {
+	case romdb.MIRRORING_HORIZONTAL:
+	case romdb.MIRRORING_VERTICAL:
+		h.Flags6 |= FLAGS6_VERTICAL_MIRRORING
+	case romdb.MIRRORING_FOUR_SCREEN:
+		h.Flags6 |= FLAGS6_FOUR_SCREEN_VRAM_ON
+	default:
+		h.Flags6 |= old.Flags6 & (FLAGS6_VERTICAL_MIRRORING | FLAGS6_FOUR_SCREEN_VRAM_ON)
+	}
+	if entry.Battery {
+		h.Flags6 |= FLAGS6_BATTERY_RAM_ON
+	}
+	h.Flags7 = byte(entry.Mapper&0xf0) | FLAGS7_NES20 | byte(old.ConsoleType())
+	h.PrgRamSize = byte(entry.Submapper&0x0f)<<4 | byte(entry.Mapper>>8&0x0f)
+	prgUnits, chrUnits := len(p.PrgBin)/PRG_BANK_SIZE, len(p.ChrBin)/CHR_BANK_SIZE
+	h.PrgSize, h.ChrSize = byte(prgUnits), byte(chrUnits)
+	h.Flags9 = byte(chrUnits>>8&0x0f)<<4 | byte(prgUnits>>8&0x0f)
+	prgRam, prgNvram, chrRam, chrNvram := entry.PrgRam, entry.PrgNvram, entry.ChrRam, entry.ChrNvram
+	if !old.IsNES20() {
+		// the entry leaves unknown RAM sizes out, keep those implied by the iNES header then
+		if prgRam == 0 && prgNvram == 0 {
+			if entry.Battery {
+				prgNvram = old.inesPrgRamBytes()
+			} else {
+				prgRam = old.inesPrgRamBytes()
+			}
+		}
+		if chrRam == 0 && chrNvram == 0 {
+			chrRam = old.ChrRamBytes()
+		}
+	}
+	h.Flags10 = ramShift(prgNvram)<<4 | ramShift(prgRam)
+	h.Flags11 = ramShift(chrNvram)<<4 | ramShift(chrRam)
+	switch entry.Region {
+	case region.REGION_PAL:
+		h.Flags12 = 1
+	case region.REGION_DENDY:
+		h.Flags12 = 3
+	default:
+		h.Flags12 = 0
+	}
+	if !old.IsNES20() {
+		// iNES headers often have garbage in the bytes NES 2.0 uses
+		h.Flags13, h.Flags14, h.Flags15 = 0, 0, 0
+	}
+
+	var corrections []string
+	correct := func(name string, from, to interface{}) {
+		if from != to {
+			corrections = append(corrections, fmt.Sprintf("%s: %v -> %v", name, from, to))
+		}
+	}
+	correct("mapper", old.GetMapperType(), h.GetMapperType())
+	correct("submapper", old.Submapper(), h.Submapper())
+	correct("mirroring", old.mirroring(), h.mirroring())
+	correct("battery", old.Flags6&FLAGS6_BATTERY_RAM_ON != 0, h.Flags6&FLAGS6_BATTERY_RAM_ON != 0)
+	correct("PRG RAM", old.PrgRamBytes(), h.PrgRamBytes())
+	correct("PRG NVRAM", old.PrgNvramBytes(), h.PrgNvramBytes())
+	correct("CHR RAM", old.ChrRamBytes(), h.ChrRamBytes())
+	correct("CHR NVRAM", old.ChrNvramBytes(), h.ChrNvramBytes())
+	correct("region", old.Region(), h.Region())
+	if len(corrections) == 0 {
+		return
+	}
+	p.Header = h
+	p.Corrections = append(p.Corrections, corrections...)
+	for _, correction := range corrections {
+		logger.GetLogger().Infof("corrected header of %q from the ROM database, %s", entry.Name, correction)
+	}
+}
+
+// ramShift returns the NES 2.0 shift count of a RAM size.
+func ramShift(size int) byte {
+	if size <= 0 {
+		return 0
+	}
+	shift := byte(1)
+	for 64<<shift < size && shift < 15 {
+		shift++
+	}
+	return shift
+}
@@ -3,7 +3,7 @@ package mappers
 import (
 	"fmt"
 	"github.com/vfreex/gones/pkg/emulator/memory"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
 )
 
 type NROMMapper struct {
@@ -13,11 +13,13 @@ type NROMMapper struct {
 
 func init() {
 	MapperConstructors[0] = NewNROMMapper
+	registerUnifBoards(0, "NROM", "NROM-128", "NROM-256", "RROM", "RROM-128")
 }
 
-func NewNROMMapper(rom *ines.INesRom) Mapper {
+func NewNROMMapper(rom *cartridge.Cartridge) Mapper {
 	p := &NROMMapper{}
 	p.prgBin = rom.PrgBin
+	p.initPrgRam(rom)
 	if len(p.prgBin) > PrgBankSize {
 		p.prgBankMapping[1] = 1
 	}
@@ -35,8 +37,12 @@ func (p *NROMMapper) PeekPrg(addr memory.Ptr) byte {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("mapper 0 PRG-ROM address %04x is not configured", addr))
 	}
+	if addr < 0x6000 {
+		// expansion area, nothing on the cartridge answers
+		return byte(addr >> 8)
+	}
 	if addr < 0x8000 {
-		return p.prgRam[addr-0x4020]
+		return p.peekPrgRam(addr)
 	}
 	bank := p.prgBankMapping[int(addr-0x8000)/PrgBankSize]
 	return p.prgBin[bank*PrgBankSize|int(addr)&0x3fff]
@@ -46,8 +52,11 @@ func (p *NROMMapper) PokePrg(addr memory.Ptr, val byte) {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("mapper 0 PRG-ROM address %04x is not configured", addr))
 	}
+	if addr < 0x6000 {
+		return
+	}
 	if addr < 0x8000 {
-		p.prgRam[addr-0x4020] = val
+		p.pokePrgRam(addr, val)
 		return
 	}
 	panic(fmt.Errorf("mapper 0 PRG-ROM address %04x is not writable", addr))
@@ -64,7 +73,7 @@ func (p *NROMMapper) PokeChr(addr memory.Ptr, val byte) {
 	if addr >= 0x2000 {
 		panic(fmt.Errorf("mapper 0 CHR-ROM/CHR-RAM %04x is not configured", addr))
 	}
-	if p.useChrRam {
+	if !p.useChrRam {
 		panic(fmt.Errorf("this mapper 0 cartridge uses CHR-ROM, writing address %04x is not possible", addr))
 	}
 	p.chrBin[addr] = val
@@ -3,7 +3,7 @@ package mappers
 import (
 	"fmt"
 	"github.com/vfreex/gones/pkg/emulator/memory"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
 )
 
 type MMC1Mapper struct {
@@ -11,16 +11,17 @@ type MMC1Mapper struct {
 	shiftRegister byte
 	writeCounter  int
 	registers     [4]byte
-	useChrRam     bool
 }
 
 func init() {
 	MapperConstructors[1] = NewMMC1Mapper
+	registerUnifBoards(1, "SAROM", "SBROM", "SCROM", "SEROM", "SFROM", "SGROM", "SHROM", "SJROM", "SKROM", "SLROM", "SL1ROM", "SNROM", "SOROM", "SUROM", "SXROM")
 }
 
-func NewMMC1Mapper(rom *ines.INesRom) Mapper {
+func NewMMC1Mapper(rom *cartridge.Cartridge) Mapper {
 	p := &MMC1Mapper{}
 	p.prgBin = rom.PrgBin
+	p.initPrgRam(rom)
 	if len(rom.ChrBin) > 0 {
 		p.chrBin = rom.ChrBin
 	} else {
@@ -28,10 +29,34 @@ func NewMMC1Mapper(rom *ines.INesRom) Mapper {
 		p.chrBin = make([]byte, ChrBankSize)
 		p.useChrRam = true
 	}
-	p.registers[0] = 0x0c
+	p.PowerUp()
 	return p
 }
 
+func (p *MMC1Mapper) PowerUp() {
+	p.shiftRegister = 0
+	p.writeCounter = 0
+	// PRG-ROM bank mode 3: fixed last bank at $C000
+	p.registers = [4]byte{0x0c, 0, 0, 0}
+	p.updatePrgRam()
+}
+
+// updatePrgRam applies the PRG-RAM chip enable of the PRG bank register,
+// and the PRG-RAM bank selected by the CHR bank register on SOROM and SXROM boards.
+func (p *MMC1Mapper) updatePrgRam() {
+	p.prgRamDisabled = p.registers[3]&0x10 != 0
+	switch {
+	case len(p.prgRam) > 0x4000:
+		// SXROM: 32 KB PRG-RAM, bank in bits 2-3
+		p.prgRamBank = int(p.registers[1] >> 2 & 0x3)
+	case len(p.prgRam) > 0x2000:
+		// SOROM: 16 KB PRG-RAM, bank in bit 3
+		p.prgRamBank = int(p.registers[1] >> 3 & 0x1)
+	default:
+		p.prgRamBank = 0
+	}
+}
+
 func (p *MMC1Mapper) mapPrgAddr(addr memory.Ptr) int {
 	offset := int(addr) & 0x3fff
 	bank := int(p.registers[3] & 0x0f)
@@ -68,8 +93,12 @@ func (p *MMC1Mapper) PeekPrg(addr memory.Ptr) byte {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("program trying to read PRG-ROM from Mapper 1 via invalid ROM address 0x%x", addr))
 	}
+	if addr < 0x6000 {
+		// expansion area, nothing on the cartridge answers
+		return byte(addr >> 8)
+	}
 	if addr < 0x8000 {
-		return p.prgRam[addr-0x4020]
+		return p.peekPrgRam(addr)
 	}
 	return p.prgBin[p.mapPrgAddr(addr)]
 }
@@ -78,9 +107,11 @@ func (p *MMC1Mapper) PokePrg(addr memory.Ptr, val byte) {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("mapper 1 PRG-ROM address 0x%x is not configured", addr))
 	}
+	if addr < 0x6000 {
+		return
+	}
 	if addr < 0x8000 {
-		// write to PRG-RAM
-		p.prgRam[addr-0x4020] = val
+		p.pokePrgRam(addr, val)
 		return
 	}
 	// write to mapper register
@@ -96,6 +127,7 @@ func (p *MMC1Mapper) PokePrg(addr memory.Ptr, val byte) {
 			p.registers[addr>>13&3] = p.shiftRegister
 			p.shiftRegister = 0
 			p.writeCounter = 0
+			p.updatePrgRam()
 			// TODO: cartridge set nametable mirroring
 			switch p.registers[0] & 0x3 {
 			case 0: // one-screen, lower bank;
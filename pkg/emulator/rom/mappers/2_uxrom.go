@@ -3,7 +3,7 @@ package mappers
 import (
 	"fmt"
 	"github.com/vfreex/gones/pkg/emulator/memory"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
 )
 
 /*
@@ -25,11 +25,13 @@ type UxRomMapper struct {
 
 func init() {
 	MapperConstructors[2] = NewUxRomMapper
+	registerUnifBoards(2, "UNROM", "UOROM")
 }
 
-func NewUxRomMapper(rom *ines.INesRom) Mapper {
+func NewUxRomMapper(rom *cartridge.Cartridge) Mapper {
 	p := &UxRomMapper{}
 	p.prgBin = rom.PrgBin
+	p.initPrgRam(rom)
 	if len(rom.ChrBin) > 0 {
 		p.chrBin = rom.ChrBin
 	} else {
@@ -40,12 +42,20 @@ func NewUxRomMapper(rom *ines.INesRom) Mapper {
 	return p
 }
 
+func (p *UxRomMapper) PowerUp() {
+	p.bankSelect = 0
+}
+
 func (p *UxRomMapper) PeekPrg(addr memory.Ptr) byte {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("program trying to read from Mapper 2 via invalid ROM address %04x", addr))
 	}
+	if addr < 0x6000 {
+		// expansion area, nothing on the cartridge answers
+		return byte(addr >> 8)
+	}
 	if addr < 0x8000 {
-		return p.prgRam[addr-0x4020]
+		return p.peekPrgRam(addr)
 	}
 	var bank int
 	if addr >= 0xc000 {
@@ -60,9 +70,11 @@ func (p *UxRomMapper) PokePrg(addr memory.Ptr, val byte) {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("mapper 2 PRG-ROM address 0x%x is not configured", addr))
 	}
+	if addr < 0x6000 {
+		return
+	}
 	if addr < 0x8000 {
-		// write to PRG-RAM
-		p.prgRam[addr-0x4020] = val
+		p.pokePrgRam(addr, val)
 		return
 	}
 	p.bankSelect = val
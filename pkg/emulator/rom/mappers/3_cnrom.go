@@ -3,7 +3,7 @@ package mappers
 import (
 	"fmt"
 	"github.com/vfreex/gones/pkg/emulator/memory"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
 )
 
 /*
@@ -28,11 +28,13 @@ type CNROMMapper struct {
 
 func init() {
 	MapperConstructors[3] = NewCNROMMapper
+	registerUnifBoards(3, "CNROM")
 }
 
-func NewCNROMMapper(rom *ines.INesRom) Mapper {
+func NewCNROMMapper(rom *cartridge.Cartridge) Mapper {
 	p := &CNROMMapper{}
 	p.prgBin = rom.PrgBin
+	p.initPrgRam(rom)
 	if len(rom.ChrBin) > 0 {
 		p.chrBin = rom.ChrBin
 	} else {
@@ -43,12 +45,20 @@ func NewCNROMMapper(rom *ines.INesRom) Mapper {
 	return p
 }
 
+func (p *CNROMMapper) PowerUp() {
+	p.bankSelect = 0
+}
+
 func (p *CNROMMapper) PeekPrg(addr memory.Ptr) byte {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("program trying to read from Mapper 3 via invalid ROM address %04x", addr))
 	}
+	if addr < 0x6000 {
+		// expansion area, nothing on the cartridge answers
+		return byte(addr >> 8)
+	}
 	if addr < 0x8000 {
-		return p.prgRam[addr-0x4020]
+		return p.peekPrgRam(addr)
 	}
 	if len(p.prgBin) == 2*PrgBankSize {
 		return p.prgBin[addr-0x8000]
@@ -61,9 +71,11 @@ func (p *CNROMMapper) PokePrg(addr memory.Ptr, val byte) {
 	if addr < 0x4020 {
 		panic(fmt.Errorf("mapper 3 PRG-ROM address 0x%x is not configured", addr))
 	}
+	if addr < 0x6000 {
+		return
+	}
 	if addr < 0x8000 {
-		// write to PRG-RAM
-		p.prgRam[addr-0x4020] = val
+		p.pokePrgRam(addr, val)
 		return
 	}
 	p.bankSelect = val
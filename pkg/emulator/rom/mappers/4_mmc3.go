@@ -0,0 +1,315 @@
+package mappers
+
+import (
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+)
+
+/*
+http://wiki.nesdev.com/w/index.php/MMC3
+PRG ROM capacity	512K
+PRG ROM window	8K + 8K + 16K fixed
+PRG RAM capacity	8K (1K internal on MMC6)
+CHR capacity	256K
+CHR window	2Kx2 + 1Kx4
+
+CPU $6000-$7FFF: 8 KB PRG RAM bank
+CPU $8000-$9FFF (or $C000-$DFFF): 8 KB switchable PRG ROM bank
+CPU $A000-$BFFF: 8 KB switchable PRG ROM bank
+CPU $C000-$DFFF (or $8000-$9FFF): 8 KB PRG ROM bank, fixed to the second-last bank
+CPU $E000-$FFFF: 8 KB PRG ROM bank, fixed to the last bank
+PPU $0000-$07FF (or $1000-$17FF): 2 KB switchable CHR bank
+PPU $0800-$0FFF (or $1800-$1FFF): 2 KB switchable CHR bank
+PPU $1000-$13FF (or $0000-$03FF): 1 KB switchable CHR bank
+PPU $1400-$17FF (or $0400-$07FF): 1 KB switchable CHR bank
+PPU $1800-$1BFF (or $0800-$0BFF): 1 KB switchable CHR bank
+PPU $1C00-$1FFF (or $0C00-$0FFF): 1 KB switchable CHR bank
+
+Registers, even and odd addresses of each 8 KB range:
+$8000 bank select, $8001 bank data, $A000 mirroring, $A001 PRG RAM protect,
+$C000 IRQ latch, $C001 IRQ reload, $E000 IRQ disable, $E001 IRQ enable.
+
+The IRQ counter is clocked by the rising edges of PPU A12, once per scanline when
+the background and the sprites use different pattern tables.
+*/
+
+// NES 2.0 submappers of mapper 4
+const (
+	MMC3_SUBMAPPER_MMC3C = 0 // Sharp MMC3C and most other revisions
+	MMC3_SUBMAPPER_MMC6  = 1
+	MMC3_SUBMAPPER_MMC3A = 4 // NEC MMC3A, IRQ behaves differently when the counter is reloaded with 0
+)
+
+const (
+	mmc3PrgBankSize = 0x2000
+	mmc3ChrBankSize = 0x400
+	// MMC6 has 1 KB of RAM at $7000-$7FFF
+	mmc6RamSize = 0x400
+)
+
+type MMC3Mapper struct {
+	mapperBase
+	submapper  int
+	fourScreen bool
+	// $8000: register selected by bits 0-2, PRG mode in bit 6, CHR A12 inversion in bit 7, MMC6 RAM enable in bit 5
+	bankSelect byte
+	// R0-R7
+	registers     [8]byte
+	mirroring     byte
+	prgRamProtect byte
+	irqLatch      byte
+	irqCounter    byte
+	irqReload     bool
+	irqEnabled    bool
+	irqPending    bool
+	// level of PPU A12 on the previous pattern fetch
+	a12 bool
+}
+
+func init() {
+	MapperConstructors[4] = NewMMC3Mapper
+	registerUnifBoards(4, "TBROM", "TEROM", "TFROM", "TGROM", "TKROM", "TLROM", "TL1ROM", "TNROM", "TR1ROM", "TSROM", "TVROM")
+}
+
+func NewMMC3Mapper(rom *cartridge.Cartridge) Mapper {
+	p := &MMC3Mapper{}
+	p.prgBin = rom.PrgBin
+	p.initPrgRam(rom)
+	p.submapper = rom.Submapper
+	p.fourScreen = rom.Mirroring == cartridge.MIRRORING_FOUR_SCREEN
+	if p.submapper == MMC3_SUBMAPPER_MMC6 && len(p.prgRam) == 0 {
+		// the RAM is inside the MMC6
+		p.prgRam = make([]byte, mmc6RamSize)
+	}
+	if len(rom.ChrBin) > 0 {
+		p.chrBin = rom.ChrBin
+	} else {
+		// cartridge use CHR-RAM rather than CHR-ROM, 8KB unless the header tells otherwise
+		chrRamSize := rom.ChrRamSize + rom.ChrNvramSize
+		if chrRamSize == 0 {
+			chrRamSize = ChrBankSize
+		}
+		p.chrBin = make([]byte, chrRamSize)
+		p.useChrRam = true
+	}
+	p.PowerUp()
+	return p
+}
+
+func (p *MMC3Mapper) PowerUp() {
+	p.bankSelect = 0
+	p.registers = [8]byte{0, 2, 4, 5, 6, 7, 0, 1}
+	p.mirroring = 0
+	// PRG-RAM enabled and writable, as most emulators start it; MMC6 starts with its RAM disabled
+	p.prgRamProtect = 0x80
+	if p.submapper == MMC3_SUBMAPPER_MMC6 {
+		p.prgRamProtect = 0
+	}
+	p.irqLatch, p.irqCounter = 0, 0
+	p.irqReload, p.irqEnabled, p.irqPending = false, false, false
+	p.a12 = false
+	p.updatePrgRam()
+}
+
+// updatePrgRam applies the PRG RAM protect register.
+func (p *MMC3Mapper) updatePrgRam() {
+	p.prgRamDisabled = p.prgRamProtect&0x80 == 0
+	p.prgRamReadOnly = p.prgRamProtect&0x40 != 0
+}
+
+func (p *MMC3Mapper) mapPrgAddr(addr memory.Ptr) int {
+	banks := len(p.prgBin) / mmc3PrgBankSize
+	var bank int
+	switch slot := int(addr-0x8000) / mmc3PrgBankSize; {
+	case slot == 1:
+		bank = int(p.registers[7])
+	case slot == 3:
+		bank = banks - 1
+	case slot == 0 && p.bankSelect&0x40 == 0 || slot == 2 && p.bankSelect&0x40 != 0:
+		bank = int(p.registers[6])
+	default:
+		bank = banks - 2
+	}
+	return bank%banks*mmc3PrgBankSize | int(addr)&(mmc3PrgBankSize-1)
+}
+
+func (p *MMC3Mapper) PeekPrg(addr memory.Ptr) byte {
+	if addr < 0x4020 {
+		panic(fmt.Errorf("mapper 4 PRG-ROM address %04x is not configured", addr))
+	}
+	if addr < 0x6000 {
+		// expansion area, nothing on the cartridge answers
+		return byte(addr >> 8)
+	}
+	if addr < 0x8000 {
+		if p.submapper == MMC3_SUBMAPPER_MMC6 {
+			return p.peekMMC6Ram(addr)
+		}
+		return p.peekPrgRam(addr)
+	}
+	return p.prgBin[p.mapPrgAddr(addr)]
+}
+
+func (p *MMC3Mapper) PokePrg(addr memory.Ptr, val byte) {
+	if addr < 0x4020 {
+		panic(fmt.Errorf("mapper 4 PRG-ROM address %04x is not configured", addr))
+	}
+	if addr < 0x6000 {
+		return
+	}
+	if addr < 0x8000 {
+		if p.submapper == MMC3_SUBMAPPER_MMC6 {
+			p.pokeMMC6Ram(addr, val)
+		} else {
+			p.pokePrgRam(addr, val)
+		}
+		return
+	}
+	switch addr & 0xe001 {
+	case 0x8000:
+		p.bankSelect = val
+	case 0x8001:
+		p.registers[p.bankSelect&0x7] = val
+	case 0xa000:
+		p.mirroring = val & 1
+		p.updateMirroring()
+	case 0xa001:
+		if p.submapper == MMC3_SUBMAPPER_MMC6 && p.bankSelect&0x20 == 0 {
+			// MMC6 ignores the RAM protect register while its RAM is disabled
+			return
+		}
+		p.prgRamProtect = val
+		p.updatePrgRam()
+	case 0xc000:
+		p.irqLatch = val
+	case 0xc001:
+		p.irqCounter = 0
+		p.irqReload = true
+	case 0xe000:
+		p.irqEnabled = false
+		p.irqPending = false
+	case 0xe001:
+		p.irqEnabled = true
+	}
+}
+
+// peekMMC6Ram reads the 1 KB of MMC6 RAM mirrored at $7000-$7FFF, whose halves are enabled separately by $A001.
+func (p *MMC3Mapper) peekMMC6Ram(addr memory.Ptr) byte {
+	if addr < 0x7000 || p.bankSelect&0x20 == 0 || p.prgRamProtect&0xa0 == 0 {
+		return byte(addr >> 8)
+	}
+	offset := int(addr) & (mmc6RamSize - 1)
+	readable := p.prgRamProtect&0x20 != 0
+	if offset >= mmc6RamSize/2 {
+		readable = p.prgRamProtect&0x80 != 0
+	}
+	if !readable {
+		// the other half is readable, this one reads as 0
+		return 0
+	}
+	return p.prgRam[offset%len(p.prgRam)]
+}
+
+func (p *MMC3Mapper) pokeMMC6Ram(addr memory.Ptr, val byte) {
+	if addr < 0x7000 || p.bankSelect&0x20 == 0 {
+		return
+	}
+	offset := int(addr) & (mmc6RamSize - 1)
+	// writing a half requires reading it enabled as well
+	writable := p.prgRamProtect&0x30 == 0x30
+	if offset >= mmc6RamSize/2 {
+		writable = p.prgRamProtect&0xc0 == 0xc0
+	}
+	if writable {
+		p.prgRam[offset%len(p.prgRam)] = val
+	}
+}
+
+func (p *MMC3Mapper) updateMirroring() {
+	if p.fourScreen {
+		return
+	}
+	if p.mirroring == 0 {
+		// vertical
+		p.notifyNametableMirroringChangeListener(0, 0)
+		p.notifyNametableMirroringChangeListener(1, 1)
+		p.notifyNametableMirroringChangeListener(2, 0)
+		p.notifyNametableMirroringChangeListener(3, 1)
+	} else {
+		// horizontal
+		p.notifyNametableMirroringChangeListener(0, 0)
+		p.notifyNametableMirroringChangeListener(1, 0)
+		p.notifyNametableMirroringChangeListener(2, 1)
+		p.notifyNametableMirroringChangeListener(3, 1)
+	}
+}
+
+func (p *MMC3Mapper) mapChrAddr(addr memory.Ptr) int {
+	if p.bankSelect&0x80 != 0 {
+		// CHR A12 inversion: 1 KB banks at $0000, 2 KB banks at $1000
+		addr ^= 0x1000
+	}
+	var bank int
+	if addr < 0x1000 {
+		// R0 and R1 select 2 KB banks, ignoring their low bit
+		bank = int(p.registers[addr>>11]&0xfe) | int(addr>>10&1)
+	} else {
+		bank = int(p.registers[2+(addr-0x1000)>>10])
+	}
+	return (bank*mmc3ChrBankSize | int(addr)&(mmc3ChrBankSize-1)) % len(p.chrBin)
+}
+
+// watchA12 clocks the IRQ counter on the rising edges of PPU A12.
+// Only pattern fetches reach the mapper, the nametable fetches pulling A12 low in between
+// are too short for the MMC3, which ignores A12 being low for less than about 3 CPU cycles.
+func (p *MMC3Mapper) watchA12(addr memory.Ptr) {
+	a12 := addr&0x1000 != 0
+	if a12 && !p.a12 {
+		p.clockIrqCounter()
+	}
+	p.a12 = a12
+}
+
+func (p *MMC3Mapper) clockIrqCounter() {
+	previous := p.irqCounter
+	reload := p.irqReload
+	if p.irqCounter == 0 || p.irqReload {
+		p.irqCounter = p.irqLatch
+	} else {
+		p.irqCounter--
+	}
+	p.irqReload = false
+	if p.irqCounter != 0 || !p.irqEnabled {
+		return
+	}
+	if p.submapper == MMC3_SUBMAPPER_MMC3A && previous == 0 && !reload {
+		// MMC3A raises no IRQ when a counter at 0 is reloaded with 0, unless the reload was requested through $C001
+		return
+	}
+	p.irqPending = true
+}
+
+func (p *MMC3Mapper) IRQ() bool {
+	return p.irqPending
+}
+
+func (p *MMC3Mapper) PeekChr(addr memory.Ptr) byte {
+	if addr >= 0x2000 {
+		panic(fmt.Errorf("mapper 4 CHR-ROM/CHR-RAM address %04x is not configured", addr))
+	}
+	p.watchA12(addr)
+	return p.chrBin[p.mapChrAddr(addr)]
+}
+
+func (p *MMC3Mapper) PokeChr(addr memory.Ptr, val byte) {
+	if addr >= 0x2000 {
+		panic(fmt.Errorf("mapper 4 CHR-ROM/CHR-RAM address %04x is not configured", addr))
+	}
+	p.watchA12(addr)
+	if !p.useChrRam {
+		// CHR-ROM ignores writes, which some games do anyway
+		return
+	}
+	p.chrBin[p.mapChrAddr(addr)] = val
+}
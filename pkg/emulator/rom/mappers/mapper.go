@@ -2,7 +2,9 @@ package mappers
 
 import (
 	"github.com/vfreex/gones/pkg/emulator/memory"
-	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"io"
 )
 
 const (
@@ -20,26 +22,136 @@ type Mapper interface {
 	PeekChr(addr memory.Ptr) byte
 	PokeChr(addr memory.Ptr, val byte)
 	AddNametableMirroringChangeListener(listener NametableMirroringChangeListener)
+	// FillPrgRam sets the power-on contents of PRG-RAM, with the trainer at $7000 if any
+	FillPrgRam(init *ram.Initializer)
+	// FillChrRam sets the power-on contents of CHR-RAM, if the cartridge has CHR-RAM rather than CHR-ROM
+	FillChrRam(init *ram.Initializer)
+	// PowerUp puts the mapper registers in their power-on state
+	PowerUp()
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
 }
 
-type MapperINesConstructor func(rom *ines.INesRom) Mapper
+// CpuClocked is implemented by mappers with hardware clocked by the CPU, like IRQ timers.
+type CpuClocked interface {
+	ClockCpu(cycles int)
+}
+
+// IRQSource is implemented by mappers raising IRQs on the CPU.
+type IRQSource interface {
+	// IRQ tells whether the mapper holds the IRQ line asserted
+	IRQ() bool
+}
+
+// DiskDrive is implemented by mappers reading disks, like the Famicom Disk System.
+type DiskDrive interface {
+	// InsertOrEject ejects the inserted disk, or inserts the selected side if none is
+	InsertOrEject()
+	// SelectNextSide selects the side to insert next, while no disk is inserted
+	SelectNextSide()
+	// DiskModified tells whether the disk was written since it was loaded or saved
+	DiskModified() bool
+	SaveDisk(w io.Writer) error
+	LoadDisk(r io.Reader) error
+}
+
+// BatteryBacked is implemented by mappers with RAM kept powered by a battery, whose contents survive power-off.
+type BatteryBacked interface {
+	// BatteryRam returns the battery-backed RAM, nil if the cartridge has no battery
+	BatteryRam() []byte
+}
+
+type MapperConstructor func(rom *cartridge.Cartridge) Mapper
+
+var MapperConstructors map[int]MapperConstructor = make(map[int]MapperConstructor)
 
-var MapperConstructors map[int]MapperINesConstructor = make(map[int]MapperINesConstructor)
+// UnifBoards maps the UNIF board names, without their "NES-" like prefix, to the mapper numbers of MapperConstructors
+var UnifBoards = make(map[string]int)
+
+func registerUnifBoards(mapper int, boards ...string) {
+	for _, board := range boards {
+		UnifBoards[board] = mapper
+	}
+}
 
 type NametableMirroringChangeListener func(logical, physical int)
 
 type mapperBase struct {
-	prgBin                            []byte
-	chrBin                            []byte
-	useChrRam                         bool
-	prgRam                            [0x3fe0]byte
+	prgBin    []byte
+	chrBin    []byte
+	useChrRam bool
+	// PRG-RAM at $6000-$7FFF, starting with the battery-backed part if any, empty if the board has none
+	prgRam      []byte
+	prgNvramLen int
+	// 512-byte trainer loaded at $7000 on power-up
+	trainer []byte
+	// 8 KB bank of PRG-RAM at $6000, for boards with more than 8 KB
+	prgRamBank int
+	// chip enable and write protection of PRG-RAM, for mappers controlling them
+	prgRamDisabled                    bool
+	prgRamReadOnly                    bool
 	nametableMirroringChangeListeners []NametableMirroringChangeListener
 }
 
+// initPrgRam sizes PRG-RAM from the cartridge, volatile and battery-backed RAM being on the same bus.
+func (p *mapperBase) initPrgRam(rom *cartridge.Cartridge) {
+	p.prgNvramLen = rom.PrgNvramSize
+	p.prgRam = make([]byte, rom.PrgNvramSize+rom.PrgRamSize)
+	p.trainer = rom.Trainer
+}
+
+// peekPrgRam reads PRG-RAM at $6000-$7FFF, or the open bus if there is no RAM or it is disabled.
+func (p *mapperBase) peekPrgRam(addr memory.Ptr) byte {
+	if len(p.prgRam) == 0 || p.prgRamDisabled {
+		return byte(addr >> 8)
+	}
+	return p.prgRam[p.prgRamAddr(addr)]
+}
+
+func (p *mapperBase) pokePrgRam(addr memory.Ptr, val byte) {
+	if len(p.prgRam) == 0 || p.prgRamDisabled || p.prgRamReadOnly {
+		return
+	}
+	p.prgRam[p.prgRamAddr(addr)] = val
+}
+
+// prgRamAddr maps a CPU address to PRG-RAM, mirroring RAM smaller than 8 KB.
+func (p *mapperBase) prgRamAddr(addr memory.Ptr) int {
+	return (p.prgRamBank*0x2000 | int(addr)&0x1fff) % len(p.prgRam)
+}
+
 func (p *mapperBase) AddNametableMirroringChangeListener(listener NametableMirroringChangeListener) {
 	p.nametableMirroringChangeListeners = append(p.nametableMirroringChangeListeners, listener)
 }
 
+func (p *mapperBase) FillPrgRam(init *ram.Initializer) {
+	// battery-backed RAM keeps its contents
+	init.Fill(p.prgRam[p.prgNvramLen:])
+	if len(p.prgRam) == 0 {
+		return
+	}
+	// $7000-$71FF of the first bank, mirrored like CPU addresses when RAM is smaller than 8 KB
+	for i, b := range p.trainer {
+		p.prgRam[(0x1000+i)%len(p.prgRam)] = b
+	}
+}
+
+func (p *mapperBase) FillChrRam(init *ram.Initializer) {
+	if p.useChrRam {
+		init.Fill(p.chrBin)
+	}
+}
+
+func (p *mapperBase) BatteryRam() []byte {
+	if p.prgNvramLen == 0 {
+		return nil
+	}
+	return p.prgRam[:p.prgNvramLen]
+}
+
+func (p *mapperBase) PowerUp() {
+}
+
 func (p *mapperBase) notifyNametableMirroringChangeListener(logical, physical int) {
 	for _, listener := range p.nametableMirroringChangeListeners {
 		listener(logical, physical)
@@ -70,11 +182,14 @@ func (p *MapperChrMemoryAdapter) Poke(addr memory.Ptr, val byte) {
 	p.mapper.PokeChr(addr, val)
 }
 
-func MapAddressSpaces(p Mapper, cpuAS, ppuAS memory.AddressSpace) {
+// MapAddressSpaces maps the mapper into the CPU and PPU address spaces,
+// returning the mappings so that the cartridge can be unmapped later.
+func MapAddressSpaces(p Mapper, cpuAS, ppuAS memory.AddressSpace) (cpuMappings, ppuMappings []memory.MappingID) {
 	prg := &MapperPrgMemoryAdapter{p}
 	chr := &MapperChrMemoryAdapter{p}
-	cpuAS.AddMapping(0x4020, 0xbfe0, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
-		prg, nil)
-	ppuAS.AddMapping(0, 0x2000, memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE,
-		chr, nil)
+	cpuMappings = append(cpuMappings, cpuAS.AddMapping(0x4020, 0xbfe0,
+		memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE|memory.MMAP_MODE_EXEC, prg, nil))
+	ppuMappings = append(ppuMappings, ppuAS.AddMapping(0, 0x2000,
+		memory.MMAP_MODE_READ|memory.MMAP_MODE_WRITE, chr, nil))
+	return
 }
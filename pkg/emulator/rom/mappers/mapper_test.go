@@ -0,0 +1,260 @@
+package mappers
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/memory"
+	"github.com/vfreex/gones/pkg/emulator/ram"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"testing"
+)
+
+func newTestCartridge(prgRam, prgNvram int) *cartridge.Cartridge {
+	return &cartridge.Cartridge{
+		PrgBin:       make([]byte, 8*PrgBankSize),
+		ChrBin:       make([]byte, ChrBankSize),
+		PrgRamSize:   prgRam,
+		PrgNvramSize: prgNvram,
+	}
+}
+
+// mmc1Write loads an MMC1 register through the serial port.
+func mmc1Write(p Mapper, addr memory.Ptr, val byte) {
+	for i := uint(0); i < 5; i++ {
+		p.PokePrg(addr, val>>i&1)
+	}
+}
+
+func TestPrgRamSize(t *testing.T) {
+	none := NewNROMMapper(newTestCartridge(0, 0))
+	none.PokePrg(0x6000, 0x42)
+	if v := none.PeekPrg(0x6000); v != 0x60 {
+		t.Errorf("board without PRG-RAM read %02x, open bus expected", v)
+	}
+	if v := none.PeekPrg(0x5000); v != 0x50 {
+		t.Errorf("expansion area read %02x, open bus expected", v)
+	}
+
+	small := NewNROMMapper(newTestCartridge(0x800, 0))
+	small.PokePrg(0x6000, 0x42)
+	if v := small.PeekPrg(0x6800); v != 0x42 {
+		t.Errorf("2 KB PRG-RAM not mirrored, read %02x", v)
+	}
+
+	battery := NewNROMMapper(newTestCartridge(0x2000, 0x2000)).(*NROMMapper)
+	if len(battery.prgRam) != 0x4000 || len(battery.BatteryRam()) != 0x2000 {
+		t.Errorf("unexpected PRG-RAM of %d bytes with %d battery-backed", len(battery.prgRam), len(battery.BatteryRam()))
+	}
+}
+
+func TestTrainer(t *testing.T) {
+	rom := newTestCartridge(0x2000, 0)
+	rom.Trainer = make([]byte, 512)
+	for i := range rom.Trainer {
+		rom.Trainer[i] = byte(i)
+	}
+	for _, constructor := range []MapperConstructor{NewNROMMapper, NewMMC1Mapper, NewUxRomMapper, NewCNROMMapper} {
+		p := constructor(rom)
+		p.PowerUp()
+		p.FillPrgRam(ram.NewInitializer(ram.INIT_ONES, 0))
+		if v0, v1, v2 := p.PeekPrg(0x7000), p.PeekPrg(0x71ff), p.PeekPrg(0x7200); v0 != 0 || v1 != 0xff || v2 != 0xff {
+			t.Errorf("%T: trainer not at $7000, read %02x %02x %02x", p, v0, v1, v2)
+		}
+	}
+}
+
+func TestMMC1PrgRam(t *testing.T) {
+	p := NewMMC1Mapper(newTestCartridge(0, 0x8000))
+	for bank := byte(0); bank < 4; bank++ {
+		// CHR bank 0 register selects the PRG-RAM bank on SXROM
+		mmc1Write(p, 0xa000, bank<<2)
+		p.PokePrg(0x6000, 0x10+bank)
+	}
+	for bank := byte(0); bank < 4; bank++ {
+		mmc1Write(p, 0xa000, bank<<2)
+		if v := p.PeekPrg(0x6000); v != 0x10+bank {
+			t.Errorf("PRG-RAM bank %d read %02x", bank, v)
+		}
+	}
+
+	// PRG-RAM disabled by bit 4 of the PRG bank register
+	mmc1Write(p, 0xe000, 0x10)
+	p.PokePrg(0x6000, 0x42)
+	if v := p.PeekPrg(0x6000); v != 0x60 {
+		t.Errorf("disabled PRG-RAM read %02x, open bus expected", v)
+	}
+	mmc1Write(p, 0xe000, 0)
+	if v := p.PeekPrg(0x6000); v != 0x13 {
+		t.Errorf("disabled PRG-RAM was written, read %02x", v)
+	}
+}
+
+// clockA12 makes a rising edge of PPU A12, as the PPU does once per scanline
+func clockA12(p Mapper) {
+	p.PeekChr(0x0000)
+	p.PeekChr(0x1000)
+}
+
+func TestMMC3Banks(t *testing.T) {
+	rom := newTestCartridge(0x2000, 0)
+	for i := range rom.PrgBin {
+		rom.PrgBin[i] = byte(i / 0x2000)
+	}
+	rom.ChrBin = make([]byte, 0x40000)
+	for i := range rom.ChrBin {
+		rom.ChrBin[i] = byte(i / 0x400)
+	}
+	p := NewMMC3Mapper(rom)
+	for r, bank := range []byte{0x10, 0x21, 0x30, 0x31, 0x32, 0x33, 5, 6} {
+		p.PokePrg(0x8000, byte(r))
+		p.PokePrg(0x8001, bank)
+	}
+	prg := func() [4]byte {
+		return [4]byte{p.PeekPrg(0x8000), p.PeekPrg(0xa000), p.PeekPrg(0xc000), p.PeekPrg(0xfffa)}
+	}
+	chr := func() [8]byte {
+		var banks [8]byte
+		for i := range banks {
+			banks[i] = p.PeekChr(memory.Ptr(i * 0x400))
+		}
+		return banks
+	}
+	if banks := prg(); banks != [4]byte{5, 6, 14, 15} {
+		t.Errorf("unexpected PRG banks %v in mode 0", banks)
+	}
+	if banks := chr(); banks != [8]byte{0x10, 0x11, 0x20, 0x21, 0x30, 0x31, 0x32, 0x33} {
+		t.Errorf("unexpected CHR banks %v", banks)
+	}
+	// PRG mode 1 and CHR A12 inversion
+	p.PokePrg(0x8000, 0xc0)
+	if banks := prg(); banks != [4]byte{14, 6, 5, 15} {
+		t.Errorf("unexpected PRG banks %v in mode 1", banks)
+	}
+	if banks := chr(); banks != [8]byte{0x30, 0x31, 0x32, 0x33, 0x10, 0x11, 0x20, 0x21} {
+		t.Errorf("unexpected inverted CHR banks %v", banks)
+	}
+
+	// PRG-RAM disabled, then write-protected through $A001
+	p.PokePrg(0x6000, 0x42)
+	p.PokePrg(0xa001, 0x00)
+	if v := p.PeekPrg(0x6000); v != 0x60 {
+		t.Errorf("disabled PRG-RAM read %02x, open bus expected", v)
+	}
+	p.PokePrg(0xa001, 0xc0)
+	p.PokePrg(0x6000, 0x24)
+	if v := p.PeekPrg(0x6000); v != 0x42 {
+		t.Errorf("write-protected PRG-RAM read %02x", v)
+	}
+}
+
+func TestMMC3IRQ(t *testing.T) {
+	for _, submapper := range []int{MMC3_SUBMAPPER_MMC3C, MMC3_SUBMAPPER_MMC3A} {
+		rom := newTestCartridge(0x2000, 0)
+		rom.Submapper = submapper
+		p := NewMMC3Mapper(rom).(*MMC3Mapper)
+		p.PokePrg(0xc000, 3)
+		p.PokePrg(0xc001, 0)
+		p.PokePrg(0xe001, 0)
+		scanlines := 0
+		for !p.IRQ() && scanlines < 10 {
+			clockA12(p)
+			scanlines++
+		}
+		// reloaded with 3 on the first edge, then 2, 1, 0
+		if scanlines != 4 {
+			t.Errorf("submapper %d: IRQ after %d scanlines, 4 expected", submapper, scanlines)
+		}
+		// A12 staying high doesn't clock the counter
+		p.PokePrg(0xe000, 0)
+		p.PokePrg(0xe001, 0)
+		p.PeekChr(0x1000)
+		p.PeekChr(0x1800)
+		if p.irqCounter != 0 || p.IRQ() {
+			t.Errorf("submapper %d: counter clocked without a rising edge of A12", submapper)
+		}
+
+		// with a latch of 0, MMC3C raises an IRQ on every scanline, MMC3A only after a $C001 write
+		p.PokePrg(0xc000, 0)
+		p.PokePrg(0xc001, 0)
+		irqs := 0
+		for i := 0; i < 4; i++ {
+			clockA12(p)
+			if p.IRQ() {
+				irqs++
+				p.PokePrg(0xe000, 0)
+				p.PokePrg(0xe001, 0)
+			}
+		}
+		if expected := map[int]int{MMC3_SUBMAPPER_MMC3C: 4, MMC3_SUBMAPPER_MMC3A: 1}[submapper]; irqs != expected {
+			t.Errorf("submapper %d: %d IRQs with a latch of 0, %d expected", submapper, irqs, expected)
+		}
+	}
+}
+
+func TestMMC6Ram(t *testing.T) {
+	rom := newTestCartridge(0, 0)
+	rom.Submapper = MMC3_SUBMAPPER_MMC6
+	p := NewMMC3Mapper(rom)
+	if v := p.PeekPrg(0x7000); v != 0x70 {
+		t.Errorf("disabled MMC6 RAM read %02x, open bus expected", v)
+	}
+	// enable the RAM, then reading and writing both halves
+	p.PokePrg(0x8000, 0x20)
+	p.PokePrg(0xa001, 0xf0)
+	p.PokePrg(0x7000, 0x11)
+	p.PokePrg(0x7200, 0x22)
+	if v0, v1 := p.PeekPrg(0x7400), p.PeekPrg(0x7600); v0 != 0x11 || v1 != 0x22 {
+		t.Errorf("MMC6 RAM not mirrored, read %02x %02x", v0, v1)
+	}
+	if v := p.PeekPrg(0x6000); v != 0x60 {
+		t.Errorf("MMC6 read %02x at $6000, open bus expected", v)
+	}
+	// upper half only readable: the lower half reads 0 and is not writable
+	p.PokePrg(0xa001, 0x80)
+	p.PokePrg(0x7000, 0x33)
+	p.PokePrg(0x7200, 0x33)
+	if v0, v1 := p.PeekPrg(0x7000), p.PeekPrg(0x7200); v0 != 0 || v1 != 0x22 {
+		t.Errorf("unexpected MMC6 RAM halves %02x %02x", v0, v1)
+	}
+}
+
+func TestFillChrRam(t *testing.T) {
+	rom := newTestCartridge(0, 0)
+	rom.ChrBin = nil
+	p := NewNROMMapper(rom)
+	p.PokeChr(0x1234, 0x42)
+	p.FillChrRam(ram.NewInitializer(ram.INIT_ONES, 0))
+	if v := p.PeekChr(0x1234); v != 0xff {
+		t.Errorf("CHR-RAM not filled on power-up, read %02x", v)
+	}
+
+	rom = newTestCartridge(0, 0)
+	p = NewNROMMapper(rom)
+	p.FillChrRam(ram.NewInitializer(ram.INIT_ONES, 0))
+	if v := p.PeekChr(0x1234); v != 0 {
+		t.Errorf("CHR-ROM filled on power-up, read %02x", v)
+	}
+}
+
+func TestChrRomWrite(t *testing.T) {
+	rom := newTestCartridge(0, 0)
+	rom.ChrBin[0x10] = 0x42
+	p := NewMMC3Mapper(rom)
+	p.PokeChr(0x10, 0x24)
+	if v := p.PeekChr(0x10); v != 0x42 {
+		t.Errorf("CHR-ROM written, read %02x", v)
+	}
+}
+
+func TestMMC3ChrRamSize(t *testing.T) {
+	rom := newTestCartridge(0, 0)
+	rom.ChrBin = nil
+	rom.ChrRamSize = 4 * ChrBankSize
+	p := NewMMC3Mapper(rom).(*MMC3Mapper)
+	if len(p.chrBin) != 4*ChrBankSize {
+		t.Errorf("expected %d bytes of CHR-RAM, got %d", 4*ChrBankSize, len(p.chrBin))
+	}
+	rom.ChrRamSize = 0
+	p = NewMMC3Mapper(rom).(*MMC3Mapper)
+	if len(p.chrBin) != ChrBankSize {
+		t.Errorf("expected %d bytes of CHR-RAM by default, got %d", ChrBankSize, len(p.chrBin))
+	}
+}
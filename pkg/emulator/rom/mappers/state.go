@@ -0,0 +1,148 @@
+package mappers
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// SaveState saves PRG-RAM and CHR-RAM, mappers with registers save them after these.
+func (p *mapperBase) SaveState(w io.Writer) error {
+	if _, err := w.Write(p.prgRam[:]); err != nil {
+		return err
+	}
+	if p.useChrRam {
+		if _, err := w.Write(p.chrBin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *mapperBase) LoadState(r io.Reader) error {
+	if _, err := io.ReadFull(r, p.prgRam[:]); err != nil {
+		return err
+	}
+	if p.useChrRam {
+		if _, err := io.ReadFull(r, p.chrBin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mmc1State struct {
+	ShiftRegister byte
+	WriteCounter  byte
+	Registers     [4]byte
+}
+
+func (p *MMC1Mapper) SaveState(w io.Writer) error {
+	if err := p.mapperBase.SaveState(w); err != nil {
+		return err
+	}
+	state := mmc1State{
+		ShiftRegister: p.shiftRegister,
+		WriteCounter:  byte(p.writeCounter),
+		Registers:     p.registers,
+	}
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (p *MMC1Mapper) LoadState(r io.Reader) error {
+	if err := p.mapperBase.LoadState(r); err != nil {
+		return err
+	}
+	var state mmc1State
+	if err := binary.Read(r, binary.LittleEndian, &state); err != nil {
+		return err
+	}
+	p.shiftRegister = state.ShiftRegister
+	p.writeCounter = int(state.WriteCounter)
+	p.registers = state.Registers
+	p.updatePrgRam()
+	return nil
+}
+
+func (p *UxRomMapper) SaveState(w io.Writer) error {
+	if err := p.mapperBase.SaveState(w); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{p.bankSelect})
+	return err
+}
+
+func (p *UxRomMapper) LoadState(r io.Reader) error {
+	if err := p.mapperBase.LoadState(r); err != nil {
+		return err
+	}
+	return binary.Read(r, binary.LittleEndian, &p.bankSelect)
+}
+
+func (p *CNROMMapper) SaveState(w io.Writer) error {
+	if err := p.mapperBase.SaveState(w); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{p.bankSelect})
+	return err
+}
+
+func (p *CNROMMapper) LoadState(r io.Reader) error {
+	if err := p.mapperBase.LoadState(r); err != nil {
+		return err
+	}
+	return binary.Read(r, binary.LittleEndian, &p.bankSelect)
+}
+
+type mmc3State struct {
+	BankSelect    byte
+	Registers     [8]byte
+	Mirroring     byte
+	PrgRamProtect byte
+	IrqLatch      byte
+	IrqCounter    byte
+	IrqReload     bool
+	IrqEnabled    bool
+	IrqPending    bool
+	A12           bool
+}
+
+func (p *MMC3Mapper) SaveState(w io.Writer) error {
+	if err := p.mapperBase.SaveState(w); err != nil {
+		return err
+	}
+	state := mmc3State{
+		BankSelect:    p.bankSelect,
+		Registers:     p.registers,
+		Mirroring:     p.mirroring,
+		PrgRamProtect: p.prgRamProtect,
+		IrqLatch:      p.irqLatch,
+		IrqCounter:    p.irqCounter,
+		IrqReload:     p.irqReload,
+		IrqEnabled:    p.irqEnabled,
+		IrqPending:    p.irqPending,
+		A12:           p.a12,
+	}
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (p *MMC3Mapper) LoadState(r io.Reader) error {
+	if err := p.mapperBase.LoadState(r); err != nil {
+		return err
+	}
+	var state mmc3State
+	if err := binary.Read(r, binary.LittleEndian, &state); err != nil {
+		return err
+	}
+	p.bankSelect = state.BankSelect
+	p.registers = state.Registers
+	p.mirroring = state.Mirroring
+	p.prgRamProtect = state.PrgRamProtect
+	p.irqLatch = state.IrqLatch
+	p.irqCounter = state.IrqCounter
+	p.irqReload = state.IrqReload
+	p.irqEnabled = state.IrqEnabled
+	p.irqPending = state.IrqPending
+	p.a12 = state.A12
+	p.updatePrgRam()
+	return nil
+}
@@ -0,0 +1,91 @@
+package patch
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+const BPS_MAGIC = "BPS1"
+
+const (
+	BPS_SOURCE_READ = iota
+	BPS_TARGET_READ
+	BPS_SOURCE_COPY
+	BPS_TARGET_COPY
+)
+
+// ApplyBPS applies a BPS patch, verifying the checksums of the ROM, the result and the patch,
+// https://github.com/blakesmith/rombp/blob/master/docs/bps_spec.md
+func ApplyBPS(rom, patch []byte) ([]byte, error) {
+	if len(patch) < len(BPS_MAGIC)+CHECKSUMS_SIZE {
+		return nil, fmt.Errorf("BPS patch is truncated")
+	}
+	sourceCRC, targetCRC, err := checkPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: patch[:len(patch)-CHECKSUMS_SIZE], pos: len(BPS_MAGIC)}
+	sourceSize, targetSize := r.number(), r.number()
+	r.bytes(r.number()) // metadata
+	if r.err != nil {
+		return nil, r.err
+	}
+	if romCRC := crc32.ChecksumIEEE(rom); len(rom) != sourceSize || romCRC != sourceCRC {
+		return nil, fmt.Errorf("ROM doesn't match the BPS patch: size %d, CRC32 %08X, expected size %d, CRC32 %08X",
+			len(rom), romCRC, sourceSize, sourceCRC)
+	}
+	if targetSize > MAX_TARGET_SIZE {
+		return nil, fmt.Errorf("BPS patch makes a ROM of %d bytes, exceeding %d bytes", targetSize, MAX_TARGET_SIZE)
+	}
+	out := make([]byte, targetSize)
+	pos, sourcePos, targetPos := 0, 0, 0
+	for r.err == nil && r.pos < len(r.data) {
+		action := r.number()
+		length := action>>2 + 1
+		if pos+length > len(out) {
+			return nil, fmt.Errorf("BPS action writes past the end of the patched ROM")
+		}
+		switch action & 3 {
+		case BPS_SOURCE_READ:
+			if pos+length > len(rom) {
+				return nil, fmt.Errorf("BPS action reads past the end of the ROM")
+			}
+			copy(out[pos:], rom[pos:pos+length])
+		case BPS_TARGET_READ:
+			copy(out[pos:], r.bytes(length))
+		case BPS_SOURCE_COPY:
+			sourcePos += signed(r.number())
+			if sourcePos < 0 || sourcePos+length > len(rom) {
+				return nil, fmt.Errorf("BPS action copies from outside the ROM")
+			}
+			copy(out[pos:], rom[sourcePos:sourcePos+length])
+			sourcePos += length
+		case BPS_TARGET_COPY:
+			targetPos += signed(r.number())
+			if targetPos < 0 || targetPos >= pos {
+				return nil, fmt.Errorf("BPS action copies from outside the patched ROM")
+			}
+			// copied byte by byte, as the copy may overlap what it writes
+			for i := 0; i < length; i++ {
+				out[pos+i] = out[targetPos]
+				targetPos++
+			}
+		}
+		pos += length
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != targetCRC {
+		return nil, fmt.Errorf("patched ROM has CRC32 %08X, expected %08X", crc, targetCRC)
+	}
+	return out, nil
+}
+
+// signed decodes the relative offsets of BPS copies, with their sign in bit 0.
+func signed(n int) int {
+	if n&1 != 0 {
+		return -(n >> 1)
+	}
+	return n >> 1
+}
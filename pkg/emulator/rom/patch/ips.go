@@ -0,0 +1,69 @@
+package patch
+
+import (
+	"fmt"
+)
+
+const (
+	IPS_MAGIC = "PATCH"
+	IPS_EOF   = "EOF"
+	// largest file IPS offsets can address
+	IPS_MAX_SIZE = 1 << 24
+)
+
+// ApplyIPS applies an IPS patch, http://fileformats.archiveteam.org/wiki/IPS_(binary_patch_format)
+// IPS patches have no checksums.
+func ApplyIPS(rom, patch []byte) ([]byte, error) {
+	r := &reader{data: patch}
+	if string(r.bytes(len(IPS_MAGIC))) != IPS_MAGIC {
+		return nil, fmt.Errorf("not an IPS patch")
+	}
+	out := append([]byte{}, rom...)
+	for {
+		record := r.bytes(3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if string(record) == IPS_EOF {
+			break
+		}
+		offset := int(record[0])<<16 | int(record[1])<<8 | int(record[2])
+		sizeBytes := r.bytes(2)
+		if r.err != nil {
+			return nil, r.err
+		}
+		size := int(sizeBytes[0])<<8 | int(sizeBytes[1])
+		var data []byte
+		if size == 0 {
+			// run-length encoded record
+			runBytes := r.bytes(2)
+			value := r.byte()
+			if r.err != nil {
+				return nil, r.err
+			}
+			data = bytesOf(int(runBytes[0])<<8|int(runBytes[1]), value)
+		} else if data = r.bytes(size); r.err != nil {
+			return nil, r.err
+		}
+		if end := offset + len(data); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+	// an extension truncates the file to the size following EOF
+	if truncate := r.bytes(3); truncate != nil {
+		size := int(truncate[0])<<16 | int(truncate[1])<<8 | int(truncate[2])
+		if size < len(out) {
+			out = out[:size]
+		}
+	}
+	return out, nil
+}
+
+func bytesOf(n int, value byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = value
+	}
+	return b
+}
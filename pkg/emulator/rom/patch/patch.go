@@ -0,0 +1,106 @@
+// Package patch applies IPS, UPS and BPS patches to ROM files in memory,
+// for translations and romhacks distributed as patches.
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/rom/ines"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MAX_TARGET_SIZE bounds the size of patched ROMs given by UPS and BPS patches, as the checksums don't protect from forged sizes.
+// It leaves room for the largest PRG and CHR ROMs of an iNES file.
+const MAX_TARGET_SIZE = 2 * ines.MAX_ROM_SIZE
+
+// PATCH_EXTENSIONS are the extensions of the patches found next to ROMs, in order of preference.
+var PATCH_EXTENSIONS = []string{".bps", ".ups", ".ips"}
+
+// Apply patches a ROM file, the format of the patch is detected from its magic.
+// The ROM is left untouched.
+func Apply(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(IPS_MAGIC)):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(UPS_MAGIC)):
+		return ApplyUPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte(BPS_MAGIC)):
+		return ApplyBPS(rom, patch)
+	default:
+		return nil, fmt.Errorf("unknown patch format")
+	}
+}
+
+// ApplyFile patches a ROM file with the patch file.
+func ApplyFile(rom []byte, patchFile string) ([]byte, error) {
+	patch, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := Apply(rom, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", patchFile, err)
+	}
+	return patched, nil
+}
+
+// Find returns the patch with the same name as the ROM file next to it, or "" if there is none.
+func Find(romFile string) string {
+	base := strings.TrimSuffix(romFile, filepath.Ext(romFile))
+	for _, ext := range PATCH_EXTENSIONS {
+		for _, name := range []string{base + ext, base + strings.ToUpper(ext)} {
+			if info, err := os.Stat(name); err == nil && !info.IsDir() {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// reader reads the fields of a patch, failing at its end.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = fmt.Errorf("patch is truncated at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// number reads a variable-length number of UPS and BPS patches.
+func (r *reader) number() int {
+	n, shift := 0, 1
+	for r.err == nil {
+		x := r.byte()
+		n += int(x&0x7f) * shift
+		if x&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		n += shift
+		if shift > 1<<42 {
+			r.err = fmt.Errorf("number too large at offset %d", r.pos)
+		}
+	}
+	return n
+}
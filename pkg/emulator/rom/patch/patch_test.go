@@ -0,0 +1,132 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func number(n int) []byte {
+	var b []byte
+	for {
+		x := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, x|0x80)
+		}
+		b = append(b, x)
+		n--
+	}
+}
+
+func withChecksums(patch, source, target []byte) []byte {
+	crcs := make([]byte, 12)
+	binary.LittleEndian.PutUint32(crcs[0:], crc32.ChecksumIEEE(source))
+	binary.LittleEndian.PutUint32(crcs[4:], crc32.ChecksumIEEE(target))
+	patch = append(patch, crcs[:8]...)
+	binary.LittleEndian.PutUint32(crcs[8:], crc32.ChecksumIEEE(patch))
+	return append(patch, crcs[8:]...)
+}
+
+var (
+	source = []byte("Hello, NES world!")
+	target = []byte("Hello, Famicom world!!")
+)
+
+func TestIPS(t *testing.T) {
+	patch := []byte(IPS_MAGIC)
+	patch = append(patch, 0, 0, 7, 0, 7)
+	patch = append(patch, "Famicom"...)
+	patch = append(patch, 0, 0, 14, 0, 8)
+	patch = append(patch, " world!!"...)
+	patch = append(patch, 0, 0, 0, 0, 0, 0, 3, 'x') // RLE
+	patch = append(patch, IPS_EOF...)
+	patched, err := Apply(source, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(patched) != "xxxlo, Famicom world!!" {
+		t.Errorf("unexpected patched ROM %q", patched)
+	}
+	if _, err := Apply(source, patch[:len(patch)-2]); err == nil {
+		t.Errorf("truncated patch accepted")
+	}
+	patched, err = Apply(source, append(patch, 0, 0, 5))
+	if err != nil || string(patched) != "xxxlo" {
+		t.Errorf("unexpected truncated ROM %q, error %v", patched, err)
+	}
+}
+
+func TestUPS(t *testing.T) {
+	patch := append([]byte(UPS_MAGIC), number(len(source))...)
+	patch = append(patch, number(len(target))...)
+	// runs of XORed differing bytes after the number of equal bytes
+	padded := append(append([]byte{}, source...), make([]byte, len(target)-len(source))...)
+	for i, last := 0, 0; i < len(target); i++ {
+		if padded[i] == target[i] {
+			continue
+		}
+		patch = append(patch, number(i-last)...)
+		for ; i < len(target) && padded[i] != target[i]; i++ {
+			patch = append(patch, padded[i]^target[i])
+		}
+		patch = append(patch, 0)
+		last = i + 1
+	}
+	patch = withChecksums(patch, source, target)
+
+	patched, err := Apply(source, patch)
+	if err != nil || !bytes.Equal(patched, target) {
+		t.Fatalf("unexpected patched ROM %q, error %v", patched, err)
+	}
+	if reverted, err := Apply(target, patch); err != nil || !bytes.Equal(reverted, source) {
+		t.Errorf("unexpected reverted ROM %q, error %v", reverted, err)
+	}
+	if _, err := Apply([]byte("Hello, SNES world!"), patch); err == nil {
+		t.Errorf("patch applied to another ROM")
+	}
+	patch[len(patch)-13] ^= 1
+	if _, err := Apply(source, patch); err == nil {
+		t.Errorf("corrupted patch accepted")
+	}
+}
+
+func TestBPS(t *testing.T) {
+	patch := append([]byte(BPS_MAGIC), number(len(source))...)
+	patch = append(patch, number(len(target))...)
+	patch = append(patch, number(0)...)
+	// "Hello, " from the ROM
+	patch = append(patch, number((7-1)<<2|BPS_SOURCE_READ)...)
+	// "Famicom" from the patch
+	patch = append(patch, number((7-1)<<2|BPS_TARGET_READ)...)
+	patch = append(patch, "Famicom"...)
+	// " world!" from the ROM
+	patch = append(patch, number((7-1)<<2|BPS_SOURCE_COPY)...)
+	patch = append(patch, number(10<<1)...)
+	// "!" from the patched ROM
+	patch = append(patch, number((1-1)<<2|BPS_TARGET_COPY)...)
+	patch = append(patch, number(20<<1)...)
+	patch = withChecksums(patch, source, target)
+
+	patched, err := Apply(source, patch)
+	if err != nil || !bytes.Equal(patched, target) {
+		t.Fatalf("unexpected patched ROM %q, error %v", patched, err)
+	}
+	if _, err := Apply(target, patch); err == nil {
+		t.Errorf("patch applied to another ROM")
+	}
+}
+
+func TestOversizedTarget(t *testing.T) {
+	for _, magic := range []string{UPS_MAGIC, BPS_MAGIC} {
+		patch := append([]byte(magic), number(len(source))...)
+		patch = append(patch, number(1<<40)...)
+		patch = append(patch, number(0)...)
+		// the checksums are as easy to forge as the size
+		patch = withChecksums(patch, source, target)
+		if _, err := Apply(source, patch); err == nil {
+			t.Errorf("%s patch making a ROM of 1 TB accepted", magic)
+		}
+	}
+}
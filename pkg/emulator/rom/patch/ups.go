@@ -0,0 +1,80 @@
+package patch
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	UPS_MAGIC = "UPS1"
+	// source, target and patch CRC32
+	CHECKSUMS_SIZE = 12
+)
+
+// ApplyUPS applies an UPS patch, verifying the checksums of the ROM, the result and the patch.
+// The patched ROM is XORed with the ROM, so an UPS patch also turns the patched ROM back into the original.
+func ApplyUPS(rom, patch []byte) ([]byte, error) {
+	if len(patch) < len(UPS_MAGIC)+CHECKSUMS_SIZE {
+		return nil, fmt.Errorf("UPS patch is truncated")
+	}
+	sourceCRC, targetCRC, err := checkPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{data: patch[:len(patch)-CHECKSUMS_SIZE], pos: len(UPS_MAGIC)}
+	sourceSize, targetSize := r.number(), r.number()
+	romCRC := crc32.ChecksumIEEE(rom)
+	if romCRC != sourceCRC && romCRC == targetCRC && len(rom) == targetSize {
+		// reverting the patch
+		sourceSize, targetSize = targetSize, sourceSize
+		sourceCRC, targetCRC = targetCRC, sourceCRC
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(rom) != sourceSize || romCRC != sourceCRC {
+		return nil, fmt.Errorf("ROM doesn't match the UPS patch: size %d, CRC32 %08X, expected size %d, CRC32 %08X",
+			len(rom), romCRC, sourceSize, sourceCRC)
+	}
+	if targetSize > MAX_TARGET_SIZE {
+		return nil, fmt.Errorf("UPS patch makes a ROM of %d bytes, exceeding %d bytes", targetSize, MAX_TARGET_SIZE)
+	}
+	out := make([]byte, targetSize)
+	copy(out, rom)
+	pos := 0
+	for r.err == nil && r.pos < len(r.data) {
+		pos += r.number()
+		for r.err == nil {
+			x := r.byte()
+			if x == 0 {
+				break
+			}
+			if pos < len(out) {
+				out[pos] ^= x
+			}
+			pos++
+		}
+		pos++
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != targetCRC {
+		return nil, fmt.Errorf("patched ROM has CRC32 %08X, expected %08X", crc, targetCRC)
+	}
+	return out, nil
+}
+
+// checkPatch verifies the CRC32 of an UPS or BPS patch, and returns the CRC32 of the source and target.
+func checkPatch(patch []byte) (source, target uint32, err error) {
+	footer := patch[len(patch)-CHECKSUMS_SIZE:]
+	source, target = le32(footer[0:]), le32(footer[4:])
+	if crc := crc32.ChecksumIEEE(patch[:len(patch)-4]); crc != le32(footer[8:]) {
+		return 0, 0, fmt.Errorf("patch is corrupted: CRC32 %08X, expected %08X", crc, le32(footer[8:]))
+	}
+	return source, target, nil
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
@@ -0,0 +1,9 @@
+// Code generated by romdb_gen from assets/romdb.xml. DO NOT EDIT.
+
+package romdb
+
+import "github.com/vfreex/gones/pkg/emulator/region"
+
+var embeddedEntries = []Entry{
+	{Name: "Super Mario Bros. (World)", CRC32: 0x3337EC46, Mirroring: MIRRORING_VERTICAL, Region: region.REGION_NTSC},
+}
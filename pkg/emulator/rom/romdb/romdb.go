@@ -0,0 +1,90 @@
+// Package romdb is a database of known cartridges, used to correct the headers of bad dumps.
+// It is keyed by the CRC32 of the PRG ROM followed by the CHR ROM, and checked with their SHA-1 when known.
+package romdb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"hash/crc32"
+	"strings"
+)
+
+//go:generate go run ../../../../cmd/romdb_gen -o entries.gen.go ../../../../assets/romdb.xml
+
+type Mirroring int
+
+const (
+	MIRRORING_HORIZONTAL Mirroring = iota
+	MIRRORING_VERTICAL
+	MIRRORING_FOUR_SCREEN
+	// mirroring controlled by the mapper
+	MIRRORING_MAPPER
+)
+
+// Entry is the board of a known cartridge.
+type Entry struct {
+	Name string
+	// of PRG ROM followed by CHR ROM
+	CRC32 uint32
+	// lowercase hex, empty when unknown
+	SHA1      string
+	Mapper    int
+	Submapper int
+	Mirroring Mirroring
+	Battery   bool
+	// RAM sizes in bytes
+	PrgRam   int
+	PrgNvram int
+	ChrRam   int
+	ChrNvram int
+	Region   region.Region
+}
+
+type Database struct {
+	entries map[uint32][]*Entry
+}
+
+func NewDatabase(entries []Entry) *Database {
+	db := &Database{entries: make(map[uint32][]*Entry)}
+	db.Add(entries)
+	return db
+}
+
+// Add adds entries, which take precedence over the existing entries for the same ROM.
+func (db *Database) Add(entries []Entry) {
+	for i := range entries {
+		entry := entries[i]
+		db.entries[entry.CRC32] = append([]*Entry{&entry}, db.entries[entry.CRC32]...)
+	}
+}
+
+func (db *Database) Len() int {
+	n := 0
+	for _, entries := range db.entries {
+		n += len(entries)
+	}
+	return n
+}
+
+// Lookup returns the entry of a ROM, or nil if it is unknown.
+func (db *Database) Lookup(prg, chr []byte) *Entry {
+	crc := crc32.Update(crc32.ChecksumIEEE(prg), crc32.IEEETable, chr)
+	candidates := db.entries[crc]
+	if len(candidates) == 0 {
+		return nil
+	}
+	h := sha1.New()
+	h.Write(prg)
+	h.Write(chr)
+	sum := hex.EncodeToString(h.Sum(nil))
+	for _, entry := range candidates {
+		if entry.SHA1 == "" || strings.EqualFold(entry.SHA1, sum) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Default is the database embedded in GoNES.
+var Default = NewDatabase(embeddedEntries)
@@ -0,0 +1,78 @@
+package romdb
+
+import (
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+const nes20dbXML = `<?xml version="1.0" encoding="UTF-8"?>
+<nes20db>
+	<game>
+		<!-- Test Game (Europe) -->
+		<prgrom size="131072" crc32="00000000"/>
+		<chrrom size="0" crc32="00000000"/>
+		<rom size="131072" crc32="%s"/>
+		<prgnvram size="8192"/>
+		<chrram size="8192"/>
+		<pcb mapper="1" submapper="5" mirroring="H" battery="1"/>
+		<console type="0" region="1"/>
+	</game>
+</nes20db>`
+
+const nesCartDBXML = `<?xml version="1.0" encoding="UTF-8"?>
+<database version="1.0">
+	<game name="Test Game">
+		<cartridge system="NES-PAL-A" crc="%s" sha1="%s">
+			<board type="NES-SNROM" mapper="1">
+				<prg size="128k"/>
+				<wram size="8k" battery="1"/>
+				<vram size="8k"/>
+			</board>
+		</cartridge>
+	</game>
+</database>`
+
+func TestParseXML(t *testing.T) {
+	crc := "4A2B7F0E"
+	for name, xml := range map[string]string{
+		"nes20db":   strings.Replace(nes20dbXML, "%s", crc, 1),
+		"NesCartDB": strings.Replace(strings.Replace(nesCartDBXML, "%s", crc, 1), "%s", "", 1),
+	} {
+		entries, err := ParseXML(strings.NewReader(xml))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("%s: 1 entry expected, got %d", name, len(entries))
+		}
+		entry := entries[0]
+		if entry.CRC32 != 0x4A2B7F0E || entry.Mapper != 1 || !entry.Battery || entry.PrgNvram != 8192 ||
+			entry.ChrRam != 8192 || entry.Region != region.REGION_PAL {
+			t.Errorf("%s: unexpected entry %+v", name, entry)
+		}
+	}
+	if _, err := ParseXML(strings.NewReader("<games/>")); err == nil {
+		t.Errorf("unknown database format accepted")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	prg, chr := []byte("PRG ROM"), []byte("CHR ROM")
+	crc := crc32.ChecksumIEEE(append(append([]byte{}, prg...), chr...))
+	db := NewDatabase([]Entry{{Name: "by CRC", CRC32: crc, Mapper: 2}})
+	if entry := db.Lookup(prg, chr); entry == nil || entry.Mapper != 2 {
+		t.Errorf("entry not found by CRC32, got %+v", entry)
+	}
+	if entry := db.Lookup(chr, prg); entry != nil {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	db.Add([]Entry{{Name: "other dump", CRC32: crc, SHA1: "0123456789abcdef0123456789abcdef01234567", Mapper: 3}})
+	if entry := db.Lookup(prg, chr); entry == nil || entry.Mapper != 2 {
+		t.Errorf("SHA-1 mismatch not skipped, got %+v", entry)
+	}
+	if db.Len() != 2 {
+		t.Errorf("2 entries expected, got %d", db.Len())
+	}
+}
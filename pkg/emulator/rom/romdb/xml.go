@@ -0,0 +1,203 @@
+package romdb
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseXML reads the entries of a NES 2.0 XML database (nes20db.xml) or a NesCartDB XML export.
+func ParseXML(r io.Reader) ([]Entry, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("no database found in XML: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "nes20db":
+				return parseNes20DB(decoder, &start)
+			case "database":
+				return parseNesCartDB(decoder, &start)
+			default:
+				return nil, fmt.Errorf("unknown database format <%s>", start.Name.Local)
+			}
+		}
+	}
+}
+
+type nes20dbSize struct {
+	Size  int    `xml:"size,attr"`
+	CRC32 string `xml:"crc32,attr"`
+	SHA1  string `xml:"sha1,attr"`
+}
+
+type nes20dbGame struct {
+	Comment  string       `xml:",comment"`
+	Rom      nes20dbSize  `xml:"rom"`
+	PrgRam   *nes20dbSize `xml:"prgram"`
+	PrgNvram *nes20dbSize `xml:"prgnvram"`
+	ChrRam   *nes20dbSize `xml:"chrram"`
+	ChrNvram *nes20dbSize `xml:"chrnvram"`
+	Pcb      struct {
+		Mapper    int    `xml:"mapper,attr"`
+		Submapper int    `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   int    `xml:"battery,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+func (p *nes20dbSize) bytes() int {
+	if p == nil {
+		return 0
+	}
+	return p.Size
+}
+
+func parseNes20DB(decoder *xml.Decoder, root *xml.StartElement) ([]Entry, error) {
+	var db struct {
+		Games []nes20dbGame `xml:"game"`
+	}
+	if err := decoder.DecodeElement(&db, root); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(db.Games))
+	for _, game := range db.Games {
+		crc, err := parseCRC32(game.Rom.CRC32)
+		if err != nil {
+			return nil, fmt.Errorf("game %q: %v", strings.TrimSpace(game.Comment), err)
+		}
+		entry := Entry{
+			Name:      strings.TrimSpace(game.Comment),
+			CRC32:     crc,
+			SHA1:      strings.ToLower(game.Rom.SHA1),
+			Mapper:    game.Pcb.Mapper,
+			Submapper: game.Pcb.Submapper,
+			Battery:   game.Pcb.Battery != 0,
+			PrgRam:    game.PrgRam.bytes(),
+			PrgNvram:  game.PrgNvram.bytes(),
+			ChrRam:    game.ChrRam.bytes(),
+			ChrNvram:  game.ChrNvram.bytes(),
+		}
+		switch game.Pcb.Mirroring {
+		case "H":
+			entry.Mirroring = MIRRORING_HORIZONTAL
+		case "V":
+			entry.Mirroring = MIRRORING_VERTICAL
+		case "4":
+			entry.Mirroring = MIRRORING_FOUR_SCREEN
+		default:
+			entry.Mirroring = MIRRORING_MAPPER
+		}
+		switch game.Console.Region {
+		case 1:
+			entry.Region = region.REGION_PAL
+		case 3:
+			entry.Region = region.REGION_DENDY
+		default:
+			entry.Region = region.REGION_NTSC
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+type nesCartDBChip struct {
+	Size    string `xml:"size,attr"`
+	Battery int    `xml:"battery,attr"`
+}
+
+type nesCartDBGame struct {
+	Name       string `xml:"name,attr"`
+	Cartridges []struct {
+		System string `xml:"system,attr"`
+		CRC    string `xml:"crc,attr"`
+		SHA1   string `xml:"sha1,attr"`
+		Board  struct {
+			Mapper int             `xml:"mapper,attr"`
+			Wram   []nesCartDBChip `xml:"wram"`
+			Vram   []nesCartDBChip `xml:"vram"`
+			Chr    []nesCartDBChip `xml:"chr"`
+			Pad    *struct {
+				H int `xml:"h,attr"`
+				V int `xml:"v,attr"`
+			} `xml:"pad"`
+		} `xml:"board"`
+	} `xml:"cartridge"`
+}
+
+func parseNesCartDB(decoder *xml.Decoder, root *xml.StartElement) ([]Entry, error) {
+	var db struct {
+		Games []nesCartDBGame `xml:"game"`
+	}
+	if err := decoder.DecodeElement(&db, root); err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, game := range db.Games {
+		for _, cartridge := range game.Cartridges {
+			crc, err := parseCRC32(cartridge.CRC)
+			if err != nil {
+				return nil, fmt.Errorf("game %q: %v", game.Name, err)
+			}
+			board := &cartridge.Board
+			entry := Entry{
+				Name:      game.Name,
+				CRC32:     crc,
+				SHA1:      strings.ToLower(cartridge.SHA1),
+				Mapper:    board.Mapper,
+				Mirroring: MIRRORING_MAPPER,
+				Region:    region.REGION_NTSC,
+			}
+			for _, wram := range board.Wram {
+				if wram.Battery != 0 {
+					entry.Battery = true
+					entry.PrgNvram += parseKiB(wram.Size)
+				} else {
+					entry.PrgRam += parseKiB(wram.Size)
+				}
+			}
+			if len(board.Chr) == 0 {
+				for _, vram := range board.Vram {
+					entry.ChrRam += parseKiB(vram.Size)
+				}
+			}
+			// the H pad connects CIRAM A10 to PPU A10 for vertical mirroring
+			if board.Pad != nil {
+				if board.Pad.H != 0 {
+					entry.Mirroring = MIRRORING_VERTICAL
+				} else if board.Pad.V != 0 {
+					entry.Mirroring = MIRRORING_HORIZONTAL
+				}
+			}
+			if strings.HasSuffix(cartridge.System, "-PAL") || strings.Contains(cartridge.System, "-PAL-") {
+				entry.Region = region.REGION_PAL
+			} else if cartridge.System == "Dendy" {
+				entry.Region = region.REGION_DENDY
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func parseCRC32(s string) (uint32, error) {
+	crc, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CRC32 %q", s)
+	}
+	return uint32(crc), nil
+}
+
+// parseKiB parses NesCartDB sizes like "8k".
+func parseKiB(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.ToLower(s), "k"))
+	return n * 1024
+}
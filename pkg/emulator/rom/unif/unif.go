@@ -0,0 +1,247 @@
+/*
+UNIF, http://wiki.nesdev.com/w/index.php/UNIF
+
+Byte     Contents
+---------------------------------------------------------------------------
+0-3      String "UNIF".
+4-7      Revision, little-endian.
+8-31     Reserved, must be zeroes.
+32-...   Chunks: 4-byte ID, 4-byte little-endian length, then the data.
+---------------------------------------------------------------------------
+Chunks used here:
+MAPR     Board name, NUL-terminated, e.g. "NES-SNROM".
+PRG0-F   PRG ROM pieces, concatenated in order.
+CHR0-F   CHR ROM pieces, concatenated in order. No CHR chunk means CHR RAM.
+PCK0-F   CRC32 of PRG0-F.
+CCK0-F   CRC32 of CHR0-F.
+MIRR     0 horizontal, 1 vertical, 2 single-screen A, 3 single-screen B, 4 four-screen, 5 mapper-controlled.
+BATR     Present for battery-backed PRG RAM.
+CTRL     Controllers bitmask.
+TVCI     0 NTSC, 1 PAL, 2 both.
+NAME     Game name, NUL-terminated.
+---------------------------------------------------------------------------
+*/
+
+package unif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/vfreex/gones/pkg/emulator/common/logger"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	UNIF_FILE_MAGIC  = "UNIF"
+	UNIF_HEADER_SIZE = 32
+)
+
+const (
+	MIRR_HORIZONTAL = iota
+	MIRR_VERTICAL
+	MIRR_SINGLE_SCREEN_A
+	MIRR_SINGLE_SCREEN_B
+	MIRR_FOUR_SCREEN
+	MIRR_MAPPER
+)
+
+const (
+	TVCI_NTSC = iota
+	TVCI_PAL
+	TVCI_BOTH
+)
+
+// prefixes of board names telling who made the board, ignored to find the mapper
+var boardPrefixes = []string{"NES-", "HVC-", "UNL-", "BTL-", "BMC-"}
+
+type UnifRom struct {
+	Revision uint32
+	// board name as in the MAPR chunk
+	Board       string
+	Name        string
+	Mirroring   byte
+	Battery     bool
+	Controllers byte
+	TV          byte
+	PrgBin      []byte
+	ChrBin      []byte
+}
+
+// NewUnifRom reads an UNIF file.
+func NewUnifRom(reader io.Reader) (*UnifRom, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < UNIF_HEADER_SIZE || string(data[:4]) != UNIF_FILE_MAGIC {
+		return nil, fmt.Errorf("no valid UNIF header is found")
+	}
+	rom := &UnifRom{
+		Revision:  binary.LittleEndian.Uint32(data[4:]),
+		Mirroring: MIRR_MAPPER,
+	}
+	var prg, chr [16][]byte
+	var prgCRC, chrCRC [16]*uint32
+	for pos := UNIF_HEADER_SIZE; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("UNIF chunk header is truncated at offset %d", pos)
+		}
+		id := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if length < 0 || length > len(data)-pos {
+			return nil, fmt.Errorf("UNIF chunk %q is truncated at offset %d", id, pos)
+		}
+		chunk := data[pos : pos+length]
+		pos += length
+
+		switch id[:3] {
+		case "PRG", "CHR", "PCK", "CCK":
+			n := strings.IndexByte("0123456789ABCDEF", id[3])
+			if n < 0 {
+				logger.GetLogger().Infof("ignoring UNIF chunk %q", id)
+				continue
+			}
+			switch id[:3] {
+			case "PRG":
+				prg[n] = chunk
+			case "CHR":
+				chr[n] = chunk
+			case "PCK", "CCK":
+				if len(chunk) < 4 {
+					return nil, fmt.Errorf("UNIF chunk %q is too short", id)
+				}
+				crc := binary.LittleEndian.Uint32(chunk)
+				if id[:3] == "PCK" {
+					prgCRC[n] = &crc
+				} else {
+					chrCRC[n] = &crc
+				}
+			}
+			continue
+		}
+		switch id {
+		case "MAPR":
+			rom.Board = cString(chunk)
+		case "NAME":
+			rom.Name = cString(chunk)
+		case "MIRR":
+			if len(chunk) > 0 {
+				rom.Mirroring = chunk[0]
+			}
+		case "BATR":
+			rom.Battery = true
+		case "CTRL":
+			if len(chunk) > 0 {
+				rom.Controllers = chunk[0]
+			}
+		case "TVCI":
+			if len(chunk) > 0 {
+				rom.TV = chunk[0]
+			}
+		default:
+			// READ, DINF, VROR and others are only informative
+		}
+	}
+	for i := range prg {
+		if prgCRC[i] != nil && crc32.ChecksumIEEE(prg[i]) != *prgCRC[i] {
+			logger.GetLogger().Warnf("UNIF chunk PRG%X doesn't match its CRC32 %08X", i, *prgCRC[i])
+		}
+		if chrCRC[i] != nil && crc32.ChecksumIEEE(chr[i]) != *chrCRC[i] {
+			logger.GetLogger().Warnf("UNIF chunk CHR%X doesn't match its CRC32 %08X", i, *chrCRC[i])
+		}
+		rom.PrgBin = append(rom.PrgBin, prg[i]...)
+		rom.ChrBin = append(rom.ChrBin, chr[i]...)
+	}
+	if rom.Board == "" {
+		return nil, fmt.Errorf("UNIF file has no board name (MAPR chunk)")
+	}
+	if len(rom.PrgBin) == 0 {
+		return nil, fmt.Errorf("UNIF file has no PRG ROM")
+	}
+	return rom, nil
+}
+
+// Mapper returns the number of the mapper emulating the board.
+func (p *UnifRom) Mapper() (int, error) {
+	board := p.Board
+	for _, prefix := range boardPrefixes {
+		board = strings.TrimPrefix(board, prefix)
+	}
+	mapper, ok := mappers.UnifBoards[board]
+	if !ok {
+		return 0, fmt.Errorf("unsupported UNIF board %q", p.Board)
+	}
+	return mapper, nil
+}
+
+// Cartridge describes the cartridge made of the board and the ROMs.
+func (p *UnifRom) Cartridge() (*cartridge.Cartridge, error) {
+	mapper, err := p.Mapper()
+	if err != nil {
+		return nil, err
+	}
+	cart := &cartridge.Cartridge{
+		Format: "UNIF",
+		Mapper: mapper,
+		Board:  p.Board,
+		PrgBin: repeat(p.PrgBin, mappers.PrgBankSize),
+		ChrBin: repeat(p.ChrBin, mappers.ChrBankSize),
+		// UNIF doesn't tell RAM sizes, assume the 8 KB of most boards
+		PrgRamSize: 8 * 1024,
+		Battery:    p.Battery,
+		Region:     region.REGION_NTSC,
+	}
+	if p.Battery {
+		cart.PrgRamSize, cart.PrgNvramSize = 0, 8*1024
+	}
+	if len(cart.ChrBin) == 0 {
+		cart.ChrRamSize = mappers.ChrBankSize
+	}
+	switch p.Mirroring {
+	case MIRR_VERTICAL:
+		cart.Mirroring = cartridge.MIRRORING_VERTICAL
+	case MIRR_SINGLE_SCREEN_A:
+		cart.Mirroring = cartridge.MIRRORING_SINGLE_SCREEN_A
+	case MIRR_SINGLE_SCREEN_B:
+		cart.Mirroring = cartridge.MIRRORING_SINGLE_SCREEN_B
+	case MIRR_FOUR_SCREEN:
+		cart.Mirroring = cartridge.MIRRORING_FOUR_SCREEN
+	}
+	if p.TV == TVCI_PAL {
+		cart.Region = region.REGION_PAL
+	}
+	return cart, nil
+}
+
+func (p *UnifRom) String() string {
+	return fmt.Sprintf("UnifRom{board: %s, name: %q, PRG: %d, CHR: %d, mirroring: %d, battery: %v}",
+		p.Board, p.Name, len(p.PrgBin), len(p.ChrBin), p.Mirroring, p.Battery)
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// repeat mirrors ROM smaller than the unit to fill it, as the address lines of a smaller chip are left unconnected.
+func repeat(rom []byte, unit int) []byte {
+	if len(rom) == 0 || len(rom)%unit == 0 {
+		return rom
+	}
+	size := (len(rom) + unit - 1) / unit * unit
+	out := make([]byte, size)
+	for i := 0; i < size; i += len(rom) {
+		copy(out[i:], rom)
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package unif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/vfreex/gones/pkg/emulator/region"
+	"github.com/vfreex/gones/pkg/emulator/rom/cartridge"
+	"github.com/vfreex/gones/pkg/emulator/rom/mappers"
+	"hash/crc32"
+	"testing"
+)
+
+func chunk(id string, data []byte) []byte {
+	header := make([]byte, 8)
+	copy(header, id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestNewUnifRom(t *testing.T) {
+	prg0, prg1 := bytes.Repeat([]byte{1}, 0x4000), bytes.Repeat([]byte{2}, 0x4000)
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(prg0))
+	file := append([]byte(UNIF_FILE_MAGIC), 7, 0, 0, 0)
+	file = append(file, make([]byte, UNIF_HEADER_SIZE-8)...)
+	file = append(file, chunk("MAPR", []byte("NES-SNROM\x00"))...)
+	file = append(file, chunk("NAME", []byte("Test Game\x00"))...)
+	file = append(file, chunk("PRG1", prg1)...)
+	file = append(file, chunk("PRG0", prg0)...)
+	file = append(file, chunk("PCK0", crc)...)
+	file = append(file, chunk("MIRR", []byte{MIRR_VERTICAL})...)
+	file = append(file, chunk("BATR", []byte{1})...)
+	file = append(file, chunk("TVCI", []byte{TVCI_PAL})...)
+
+	rom, err := NewUnifRom(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rom.Revision != 7 || rom.Board != "NES-SNROM" || rom.Name != "Test Game" || !rom.Battery || len(rom.ChrBin) != 0 {
+		t.Errorf("unexpected UNIF ROM %v", rom)
+	}
+	if !bytes.Equal(rom.PrgBin, append(append([]byte{}, prg0...), prg1...)) {
+		t.Errorf("PRG chunks not concatenated in order")
+	}
+
+	cart, err := rom.Cartridge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cart.Mapper != mappers.UnifBoards["SNROM"] || cart.Board != "NES-SNROM" || len(cart.PrgBin) != 0x8000 ||
+		cart.ChrRamSize != 8192 || cart.PrgNvramSize != 8192 || !cart.Battery ||
+		cart.Mirroring != cartridge.MIRRORING_VERTICAL || cart.Region != region.REGION_PAL {
+		t.Errorf("unexpected cartridge %v", cart)
+	}
+
+	rom.Board = "UNL-SOMETHING"
+	if _, err := rom.Cartridge(); err == nil {
+		t.Errorf("unknown board accepted")
+	}
+	if _, err := NewUnifRom(bytes.NewReader(file[:len(file)-1])); err == nil {
+		t.Errorf("truncated file accepted")
+	}
+}
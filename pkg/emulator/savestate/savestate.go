@@ -0,0 +1,160 @@
+/*
+Save states are stored in a versioned, chunked binary format, all integers in little endian:
+
+Byte     Contents
+---------------------------------------------------------------------------
+0-3      String "GNSS" used to recognize GoNES save states.
+4-5      Format version.
+6-...    Chunks, until EOF:
+         0-3    Tag naming the component, e.g. "CPU ".
+         4-5    Chunk version, bumped when the component changes its layout.
+         6-9    Payload length in bytes.
+         10-... Payload.
+---------------------------------------------------------------------------
+
+Readers skip chunks they don't know about, so new components can add chunks
+without breaking existing states.
+*/
+
+package savestate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	FILE_MAGIC     = "GNSS"
+	FORMAT_VERSION = 1
+)
+
+// Stateful is implemented by components whose state can be saved and restored.
+type Stateful interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+type chunkHeader struct {
+	Tag     [4]byte
+	Version uint16
+	Length  uint32
+}
+
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := struct {
+		Magic   [4]byte
+		Version uint16
+	}{Version: FORMAT_VERSION}
+	copy(header.Magic[:], FILE_MAGIC)
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+func (p *Writer) WriteChunk(tag string, version uint16, component Stateful) error {
+	payload := &bytes.Buffer{}
+	if err := component.SaveState(payload); err != nil {
+		return fmt.Errorf("error saving state chunk %q: %v", tag, err)
+	}
+	header := chunkHeader{Version: version, Length: uint32(payload.Len())}
+	copy(header.Tag[:], tag)
+	if err := binary.Write(p.w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	_, err := p.w.Write(payload.Bytes())
+	return err
+}
+
+type chunk struct {
+	version uint16
+	payload []byte
+}
+
+type Reader struct {
+	version uint16
+	chunks  map[string]chunk
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	header := struct {
+		Magic   [4]byte
+		Version uint16
+	}{}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("error reading save state header: %v", err)
+	}
+	if string(header.Magic[:]) != FILE_MAGIC {
+		return nil, fmt.Errorf("not a GoNES save state")
+	}
+	if header.Version > FORMAT_VERSION {
+		return nil, fmt.Errorf("save state format version %d is newer than supported version %d",
+			header.Version, FORMAT_VERSION)
+	}
+	reader := &Reader{version: header.Version, chunks: map[string]chunk{}}
+	for {
+		var ch chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &ch); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading save state chunk header: %v", err)
+		}
+		// grow the payload as data arrives rather than trusting the length of a corrupt header
+		payload := &bytes.Buffer{}
+		n, err := payload.ReadFrom(io.LimitReader(r, int64(ch.Length)))
+		if err == nil && n < int64(ch.Length) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading save state chunk %q: %v", string(ch.Tag[:]), err)
+		}
+		reader.chunks[string(ch.Tag[:])] = chunk{version: ch.Version, payload: payload.Bytes()}
+	}
+	return reader, nil
+}
+
+// CheckChunk tells whether the chunk exists with a version in [minVersion, maxVersion],
+// to reject a state before restoring any component from it.
+func (p *Reader) CheckChunk(tag string, minVersion, maxVersion uint16) error {
+	ch, ok := p.chunks[tag]
+	if !ok {
+		return fmt.Errorf("save state has no %q chunk", tag)
+	}
+	if ch.version > maxVersion {
+		return fmt.Errorf("save state chunk %q version %d is newer than supported version %d",
+			tag, ch.version, maxVersion)
+	}
+	if ch.version < minVersion {
+		return fmt.Errorf("save state chunk %q version %d is older than supported version %d",
+			tag, ch.version, minVersion)
+	}
+	return nil
+}
+
+// ReadChunk restores a component from its chunk.
+// The chunk must exist and must not be newer than maxVersion.
+func (p *Reader) ReadChunk(tag string, maxVersion uint16, component Stateful) error {
+	if err := p.CheckChunk(tag, 0, maxVersion); err != nil {
+		return err
+	}
+	ch := p.chunks[tag]
+	r := bytes.NewReader(ch.payload)
+	if err := component.LoadState(r); err != nil {
+		return fmt.Errorf("error loading save state chunk %q: %v", tag, err)
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("save state chunk %q has %d unexpected trailing bytes", tag, r.Len())
+	}
+	return nil
+}
+
+func (p *Reader) HasChunk(tag string) bool {
+	_, ok := p.chunks[tag]
+	return ok
+}
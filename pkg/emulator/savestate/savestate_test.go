@@ -0,0 +1,99 @@
+package savestate
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type testComponent struct {
+	data []byte
+}
+
+func (p *testComponent) SaveState(w io.Writer) error {
+	_, err := w.Write(p.data)
+	return err
+}
+
+func (p *testComponent) LoadState(r io.Reader) error {
+	_, err := io.ReadFull(r, p.data)
+	return err
+}
+
+func TestRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChunk("TEST", 1, &testComponent{[]byte{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	// a chunk from a newer component this reader doesn't know about
+	if err := w.WriteChunk("NEW ", 7, &testComponent{[]byte{4, 5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	component := &testComponent{make([]byte, 3)}
+	if err := r.ReadChunk("TEST", 1, component); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(component.data, []byte{1, 2, 3}) {
+		t.Errorf("expected [1 2 3], got %v", component.data)
+	}
+	if err := r.ReadChunk("NEW ", 1, &testComponent{make([]byte, 2)}); err == nil {
+		t.Error("expected reading a chunk newer than supported to fail")
+	}
+	if err := r.ReadChunk("GONE", 1, component); err == nil {
+		t.Error("expected reading a missing chunk to fail")
+	}
+	if err := r.ReadChunk("TEST", 1, &testComponent{make([]byte, 2)}); err == nil {
+		t.Error("expected a chunk with trailing bytes to fail")
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := NewWriter(buf)
+	w.WriteChunk("TEST", 1, &testComponent{[]byte{1, 2, 3}})
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("expected a truncated state to fail")
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("NES\x1a\x01\x00"))); err == nil {
+		t.Error("expected a state with a bad magic to fail")
+	}
+	// a corrupt chunk length claiming far more data than the state holds
+	corrupt := append([]byte(nil), buf.Bytes()...)
+	copy(corrupt[12:16], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := NewReader(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected a state with a corrupt chunk length to fail")
+	}
+}
+
+func TestCheckChunk(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChunk("TEST", 2, &testComponent{[]byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckChunk("TEST", 2, 3); err != nil {
+		t.Errorf("supported chunk rejected: %v", err)
+	}
+	if err := r.CheckChunk("TEST", 3, 3); err == nil {
+		t.Error("expected a chunk older than supported to be rejected")
+	}
+	if err := r.CheckChunk("TEST", 1, 1); err == nil {
+		t.Error("expected a chunk newer than supported to be rejected")
+	}
+}